@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiScope is what a bearer token allows. Every token can read; only write tokens can change the collection.
+type apiScope int
+
+const (
+	scopeRead apiScope = iota + 1
+	scopeWrite
+)
+
+// apiTokens maps each accepted bearer token to its scope
+type apiTokens map[string]apiScope
+
+// loadAPITokens reads the comma-separated API_TOKENS and API_WRITE_TOKENS
+func loadAPITokens() apiTokens {
+	tokens := make(apiTokens)
+	for key, scope := range map[string]apiScope{"API_TOKENS": scopeRead, "API_WRITE_TOKENS": scopeWrite} {
+		for _, token := range strings.Split(os.Getenv(key), ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens[token] = max(tokens[token], scope)
+			}
+		}
+	}
+	return tokens
+}
+
+// scope returns the scope of the bearer token in the Authorization header, or 0 if it is missing or unknown
+func (t apiTokens) scope(r *http.Request) apiScope {
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || given == "" {
+		return 0
+	}
+	// compare against every token so the response time doesn't reveal how much of a token matched
+	var scope apiScope
+	for token, s := range t {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			scope = s
+		}
+	}
+	return scope
+}
+
+// apiError is an error with the HTTP status it should be reported with
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e apiError) Error() string {
+	return e.Message
+}
+
+// apiHandler serves one API endpoint. Returned errors are written as JSON by the wrapping authorize.
+type apiHandler func(ctx context.Context, w http.ResponseWriter, r *http.Request) error
+
+// APIServer serves the quote collection over HTTP as JSON
+type APIServer struct {
+	DB     QuoteStore
+	Tokens apiTokens
+}
+
+// startAPI starts the HTTP API on API_ADDR. It returns a nil server when API_ADDR is not set.
+func startAPI(db QuoteStore) (*http.Server, error) {
+	addr := os.Getenv("API_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	api := &APIServer{DB: db, Tokens: loadAPITokens()}
+	if len(api.Tokens) == 0 {
+		return nil, errors.New("API_ADDR is set but API_TOKENS and API_WRITE_TOKENS are empty")
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           api.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("serving the API", "addr", addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("API server stopped", "err", err)
+		}
+	}()
+	return srv, nil
+}
+
+// shutdownServer stops an optional HTTP server, waiting up to the database timeout for requests in flight
+func shutdownServer(srv *http.Server) {
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("error shutting down server", "addr", srv.Addr, "err", err)
+	}
+}
+
+// routes maps every endpoint. Reads mirror the /quote subcommands; writes need a write token.
+func (a *APIServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/guilds/{guild}/quotes", a.authorize(scopeRead, a.listQuotes))
+	mux.Handle("GET /api/guilds/{guild}/quotes/{id}", a.authorize(scopeRead, a.getQuote))
+	mux.Handle("GET /api/guilds/{guild}/quotes/random", a.authorize(scopeRead, a.randomQuote))
+	mux.Handle("GET /api/guilds/{guild}/quotes/latest", a.authorize(scopeRead, a.latestQuote))
+	mux.Handle("GET /api/guilds/{guild}/search", a.authorize(scopeRead, a.searchQuotes))
+	mux.Handle("GET /api/guilds/{guild}/leaderboard", a.authorize(scopeRead, a.leaderboard))
+	mux.Handle("GET /api/guilds/{guild}/count", a.authorize(scopeRead, a.count))
+	mux.Handle("POST /api/guilds/{guild}/quotes", a.authorize(scopeWrite, a.createQuote))
+	mux.Handle("DELETE /api/guilds/{guild}/quotes/{id}", a.authorize(scopeWrite, a.deleteQuote))
+	return mux
+}
+
+// authorize checks the bearer token against the scope an endpoint needs, then runs it with the database timeout and
+// reports any error it returns
+func (a *APIServer) authorize(need apiScope, h apiHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch scope := a.Tokens.scope(r); {
+		case scope == 0:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="quotes"`)
+			writeAPIError(r.Context(), w, apiError{Status: http.StatusUnauthorized, Message: "missing or invalid bearer token"})
+			return
+		case scope < need:
+			writeAPIError(r.Context(), w, apiError{Status: http.StatusForbidden, Message: "this token is read-only"})
+			return
+		}
+
+		ctx := withLogAttrs(r.Context(),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("guild", r.PathValue("guild")),
+		)
+		ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+		defer cancel()
+
+		if err := h(ctx, w, r); err != nil {
+			writeAPIError(ctx, w, err)
+		}
+	})
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("error writing API response", "err", err)
+	}
+}
+
+// writeAPIError reports err as a JSON error. Missing rows are a 404 and anything unexpected is a 500 whose details
+// stay in the log.
+func writeAPIError(ctx context.Context, w http.ResponseWriter, err error) {
+	var apiErr apiError
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, sql.ErrNoRows):
+		apiErr = apiError{Status: http.StatusNotFound, Message: "no matching quote"}
+	default:
+		slog.ErrorContext(ctx, "error serving API request", "err", err)
+		apiErr = apiError{Status: http.StatusInternalServerError, Message: "internal error"}
+	}
+	writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+}
+
+// quoteID parses the {id} path segment
+func quoteID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid quote ID %q", r.PathValue("id"))}
+	}
+	return id, nil
+}
+
+// quoteRecords converts quotes to their exported shape, never returning null
+func quoteRecords(quotes []Quote) []quoteRecord {
+	records := make([]quoteRecord, 0, len(quotes))
+	for _, q := range quotes {
+		records = append(records, newQuoteRecord(q))
+	}
+	return records
+}
+
+// listQuotes returns every quote in the guild, oldest first
+func (a *APIServer) listQuotes(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	quotes, err := a.DB.listQuotes(ctx, r.PathValue("guild"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, quoteRecords(quotes))
+	return nil
+}
+
+// getQuote returns a quote by its ID
+func (a *APIServer) getQuote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := quoteID(r)
+	if err != nil {
+		return err
+	}
+	quote, err := a.DB.getQuote(ctx, r.PathValue("guild"), id)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newQuoteRecord(quote))
+	return nil
+}
+
+// randomQuote returns a random quote, optionally only from the quotee with the user ID in ?user=
+func (a *APIServer) randomQuote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var quote Quote
+	var err error
+	if user := r.URL.Query().Get("user"); user != "" {
+		quote, err = a.DB.getRandUserQuote(ctx, r.PathValue("guild"), user, "")
+	} else {
+		quote, err = a.DB.getRandQuote(ctx, r.PathValue("guild"), "")
+	}
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newQuoteRecord(quote))
+	return nil
+}
+
+// latestQuote returns the newest quote, optionally only from the quotee with the user ID in ?user=
+func (a *APIServer) latestQuote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var quote Quote
+	var err error
+	if user := r.URL.Query().Get("user"); user != "" {
+		quote, err = a.DB.getLatestUserQuote(ctx, r.PathValue("guild"), user)
+	} else {
+		quote, err = a.DB.getLatestQuote(ctx, r.PathValue("guild"))
+	}
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, newQuoteRecord(quote))
+	return nil
+}
+
+// searchQuotes runs ?q= with the same syntax as /quote search, ordered by ?sort=relevance or date
+func (a *APIServer) searchQuotes(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	if q.Get("q") == "" {
+		return apiError{Status: http.StatusBadRequest, Message: "missing search query q"}
+	}
+
+	order := searchByRelevance
+	if s := q.Get("sort"); s != "" {
+		order = searchOrder(s)
+		if order != searchByRelevance && order != searchByDate {
+			return apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("sort must be %s or %s", searchByRelevance, searchByDate)}
+		}
+	}
+
+	quotes, err := a.DB.searchQuote(ctx, r.PathValue("guild"), q.Get("q"), order, "")
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, quoteRecords(quotes))
+	return nil
+}
+
+// leaderboard returns the quotees, or the quoters with ?mode=quoter, with the most quotes. ?period= or ?from= and
+// ?to= dates limit it to a window of time, as /quote leaderboard does.
+func (a *APIServer) leaderboard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	lq, err := newLeaderboardQuery(leaderboardMode(q.Get("mode")), leaderboardPeriod(q.Get("period")), q.Get("from"), q.Get("to"), time.Now(), time.Local)
+	if err != nil {
+		return apiError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	leaderboard, err := a.DB.getLeaderboard(ctx, r.PathValue("guild"), lq)
+	if err != nil {
+		return err
+	}
+	if leaderboard == nil {
+		leaderboard = []leaderboardEntry{}
+	}
+	writeJSON(w, http.StatusOK, leaderboard)
+	return nil
+}
+
+// count returns the number of quotes in the guild
+func (a *APIServer) count(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	count, err := a.DB.quoteCount(ctx, r.PathValue("guild"))
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"count": count})
+	return nil
+}
+
+// maxAPIBody caps the size of a request body; a quote is far smaller than this
+const maxAPIBody = 64 << 10
+
+// apiNewQuote is the body of a request to add a quote. Quotee and quoter may be mentions or user IDs.
+type apiNewQuote struct {
+	Quote     string    `json:"quote"`
+	Quotee    string    `json:"quotee"`
+	Quoter    string    `json:"quoter"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// createQuote adds a quote to the guild, timestamped now unless the body gives createdAt
+func (a *APIServer) createQuote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var body apiNewQuote
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody)).Decode(&body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return apiError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("body is larger than %d bytes", maxAPIBody)}
+		}
+		return apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("invalid JSON body: %v", err)}
+	}
+
+	quote := Quote{
+		Quote:     strings.TrimSpace(body.Quote),
+		CreatedAt: body.CreatedAt,
+		GuildID:   r.PathValue("guild"),
+	}
+	if quote.Quote == "" {
+		return apiError{Status: http.StatusBadRequest, Message: "quote is empty"}
+	}
+	var ok bool
+	if quote.Quotee, ok = normalizeMention(body.Quotee); !ok {
+		return apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("quotee %q is not a user mention or ID", body.Quotee)}
+	}
+	if quote.Quoter, ok = normalizeMention(body.Quoter); !ok {
+		return apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf("quoter %q is not a user mention or ID", body.Quoter)}
+	}
+	if quote.CreatedAt.IsZero() {
+		quote.CreatedAt = time.Now()
+	}
+
+	var err error
+	quote.ID, err = a.DB.createQuote(ctx, quote)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, newQuoteRecord(quote))
+	return nil
+}
+
+// deleteQuote removes a quote from the guild
+func (a *APIServer) deleteQuote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	id, err := quoteID(r)
+	if err != nil {
+		return err
+	}
+	if err := a.DB.deleteQuote(ctx, r.PathValue("guild"), id); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
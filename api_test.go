@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testReadToken  = "read-token"
+	testWriteToken = "write-token"
+)
+
+// newTestAPI serves the API over a memStore holding two quotes in testGuild and one in another guild
+func newTestAPI(t *testing.T) (*httptest.Server, QuoteStore) {
+	t.Helper()
+	db := newMemStore()
+	insertQuote(t, db, Quote{Quote: "first words", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, db, Quote{Quote: "second words", Quotee: "<@2>", Quoter: "<@1>", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, db, Quote{Quote: "elsewhere", Quotee: "<@3>", Quoter: "<@3>", CreatedAt: time.Now(), GuildID: "200"})
+
+	api := &APIServer{DB: db, Tokens: apiTokens{testReadToken: scopeRead, testWriteToken: scopeWrite}}
+	srv := httptest.NewServer(api.routes())
+	t.Cleanup(srv.Close)
+	return srv, db
+}
+
+// apiRequest sends a request with the given bearer token and decodes a JSON response into out, if not nil
+func apiRequest(t *testing.T, srv *httptest.Server, method, path, token, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIAuthorization(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	body := `{"quote": "new", "quotee": "<@123456789012345678>", "quoter": "223456789012345678"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"no token", http.MethodGet, "/api/guilds/100/count", "", "", http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/api/guilds/100/count", "nope", "", http.StatusUnauthorized},
+		{"read token reads", http.MethodGet, "/api/guilds/100/count", testReadToken, "", http.StatusOK},
+		{"read token cannot write", http.MethodPost, "/api/guilds/100/quotes", testReadToken, body, http.StatusForbidden},
+		{"write token writes", http.MethodPost, "/api/guilds/100/quotes", testWriteToken, body, http.StatusCreated},
+		{"write token reads", http.MethodGet, "/api/guilds/100/count", testWriteToken, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiRequest(t, srv, tt.method, tt.path, tt.token, tt.body, nil); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIReads(t *testing.T) {
+	srv, _ := newTestAPI(t)
+
+	var quotes []quoteRecord
+	if status := apiRequest(t, srv, http.MethodGet, "/api/guilds/100/quotes", testReadToken, "", &quotes); status != http.StatusOK {
+		t.Fatalf("list status = %d", status)
+	}
+	if len(quotes) != 2 || quotes[0].Quote != "first words" {
+		t.Errorf("list = %+v, want the two quotes of guild 100", quotes)
+	}
+
+	var quote quoteRecord
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/quotes/2", testReadToken, "", &quote)
+	if quote.ID != 2 || quote.Quote != "second words" {
+		t.Errorf("get = %+v, want #2", quote)
+	}
+
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/quotes/latest", testReadToken, "", &quote)
+	if quote.ID != 2 {
+		t.Errorf("latest = #%d, want #2", quote.ID)
+	}
+
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/quotes/random?user=1", testReadToken, "", &quote)
+	if quote.Quotee != "<@1>" {
+		t.Errorf("random for user 1 = %+v", quote)
+	}
+
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/search?q=second", testReadToken, "", &quotes)
+	if len(quotes) != 1 || quotes[0].ID != 2 {
+		t.Errorf("search = %+v, want #2", quotes)
+	}
+
+	var leaderboard []leaderboardEntry
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/leaderboard", testReadToken, "", &leaderboard)
+	if len(leaderboard) != 2 {
+		t.Errorf("leaderboard = %+v, want 2 quotees", leaderboard)
+	}
+
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/100/leaderboard?mode=quoter&period=week", testReadToken, "", &leaderboard)
+	if len(leaderboard) != 2 || leaderboard[0] != (leaderboardEntry{User: "<@1>", Count: 1}) {
+		t.Errorf("quoter leaderboard = %+v, want quoters 1 and 2", leaderboard)
+	}
+
+	var count map[string]int
+	apiRequest(t, srv, http.MethodGet, "/api/guilds/200/count", testReadToken, "", &count)
+	if count["count"] != 1 {
+		t.Errorf("count = %v, want 1", count)
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	srv, _ := newTestAPI(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"quote from another guild", http.MethodGet, "/api/guilds/200/quotes/1", "", http.StatusNotFound},
+		{"malformed ID", http.MethodGet, "/api/guilds/100/quotes/abc", "", http.StatusBadRequest},
+		{"empty guild", http.MethodGet, "/api/guilds/300/quotes/random", "", http.StatusNotFound},
+		{"missing search query", http.MethodGet, "/api/guilds/100/search", "", http.StatusBadRequest},
+		{"bad sort", http.MethodGet, "/api/guilds/100/search?q=words&sort=size", "", http.StatusBadRequest},
+		{"bad leaderboard period", http.MethodGet, "/api/guilds/100/leaderboard?period=decade", "", http.StatusBadRequest},
+		{"bad leaderboard date", http.MethodGet, "/api/guilds/100/leaderboard?from=yesterday", "", http.StatusBadRequest},
+		{"bad quotee", http.MethodPost, "/api/guilds/100/quotes", `{"quote": "x", "quotee": "bob", "quoter": "2"}`, http.StatusBadRequest},
+		{"bad body", http.MethodPost, "/api/guilds/100/quotes", `{`, http.StatusBadRequest},
+		{"oversize body", http.MethodPost, "/api/guilds/100/quotes", `{"quote": "` + strings.Repeat("x", maxAPIBody) + `"}`, http.StatusRequestEntityTooLarge},
+		{"delete missing", http.MethodDelete, "/api/guilds/100/quotes/99", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]string
+			if got := apiRequest(t, srv, tt.method, tt.path, testWriteToken, tt.body, &body); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+			if body["error"] == "" {
+				t.Error("expected an error message in the body")
+			}
+		})
+	}
+}
+
+func TestAPIWrites(t *testing.T) {
+	srv, db := newTestAPI(t)
+
+	var created quoteRecord
+	status := apiRequest(t, srv, http.MethodPost, "/api/guilds/100/quotes", testWriteToken,
+		`{"quote": "from the dashboard", "quotee": "123456789012345678", "quoter": "<@!223456789012345678>"}`, &created)
+	if status != http.StatusCreated {
+		t.Fatalf("create status = %d", status)
+	}
+	if created.ID == 0 || created.Quotee != "<@123456789012345678>" || created.Quoter != "<@223456789012345678>" {
+		t.Errorf("created = %+v", created)
+	}
+
+	if status := apiRequest(t, srv, http.MethodDelete, "/api/guilds/100/quotes/1", testWriteToken, "", nil); status != http.StatusNoContent {
+		t.Errorf("delete status = %d", status)
+	}
+
+	count, err := db.quoteCount(context.Background(), testGuild)
+	if err != nil {
+		t.Fatalf("quoteCount: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2 after one create and one delete", count)
+	}
+}
+
+func TestLoadAPITokens(t *testing.T) {
+	t.Setenv("API_TOKENS", "a, b")
+	t.Setenv("API_WRITE_TOKENS", "b,c")
+
+	tokens := loadAPITokens()
+	want := apiTokens{"a": scopeRead, "b": scopeWrite, "c": scopeWrite}
+	if len(tokens) != len(want) {
+		t.Fatalf("tokens = %v, want %v", tokens, want)
+	}
+	for token, scope := range want {
+		if tokens[token] != scope {
+			t.Errorf("scope of %q = %d, want %d", token, tokens[token], scope)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // animated avatars are served as GIFs
+	_ "image/jpeg"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// cardUser is how a card shows the quotee. A nil Avatar is drawn as the first letter of Name.
+type cardUser struct {
+	Name   string
+	Avatar image.Image
+}
+
+// quoteCard is everything a quote card shows, already formatted so rendering depends on nothing else
+type quoteCard struct {
+	Text   string
+	Quotee cardUser
+	// Footer holds the number and date of the quote
+	Footer string
+}
+
+// newQuoteCard lays out a quote the way its embed shows it
+func newQuoteCard(q Quote, quotee cardUser) quoteCard {
+	return quoteCard{
+		Text:   q.Quote,
+		Quotee: quotee,
+		Footer: fmt.Sprintf("#%d · %s", q.ID, quoteTime(q)),
+	}
+}
+
+// cardName is the file name a card for quote id is attached as
+func cardName(id int64) string {
+	return fmt.Sprintf("quote-%d.png", id)
+}
+
+const (
+	cardWidth  = 1000
+	cardHeight = 500
+	cardMargin = 60
+	avatarSize = 160
+	// the quote text is set as large as fits its box, down to cardMinText
+	cardMaxText = 56
+	cardMinText = 20
+	cardTextTop = 60
+	// cardTextHeight leaves room below the quote for the quotee's name and the footer
+	cardTextHeight = 300
+)
+
+var (
+	cardBackground = chartBackground
+	cardText       = chartText
+	cardMuted      = color.RGBA{0x94, 0x9b, 0xa4, 0xff}
+	cardAccent     = chartBar
+)
+
+// cardFonts are the Go fonts compiled into the binary, so cards render the same everywhere
+var cardFonts = sync.OnceValue(func() map[string]*opentype.Font {
+	fonts := make(map[string]*opentype.Font)
+	for name, ttf := range map[string][]byte{"regular": goregular.TTF, "bold": gobold.TTF, "italic": goitalic.TTF} {
+		f, err := opentype.Parse(ttf)
+		if err != nil {
+			panic(fmt.Sprintf("cardFonts: %s: %v", name, err))
+		}
+		fonts[name] = f
+	}
+	return fonts
+})
+
+// cardFace returns a face of one of the cardFonts at size points
+func cardFace(name string, size float64) font.Face {
+	face, err := opentype.NewFace(cardFonts()[name], &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		panic(fmt.Sprintf("cardFace: %s: %v", name, err))
+	}
+	return face
+}
+
+// renderCard draws a quote card as a PNG: the avatar on the left, and to its right the quote set as large as it fits
+// above the quotee's name and the footer
+func renderCard(card quoteCard) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, cardWidth, cardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(cardBackground), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 8, cardHeight), image.NewUniform(cardAccent), image.Point{}, draw.Src)
+
+	avatar := image.Rect(cardMargin, (cardHeight-avatarSize)/2, cardMargin+avatarSize, (cardHeight+avatarSize)/2)
+	drawAvatar(img, avatar, card.Quotee)
+
+	left := avatar.Max.X + cardMargin
+	width := cardWidth - cardMargin - left
+
+	// center the quote in its box
+	face, lines := fitText("“"+card.Text+"”", width, cardTextHeight)
+	lineHeight := face.Metrics().Height.Ceil()
+	y := cardTextTop + (cardTextHeight-len(lines)*lineHeight)/2 + face.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		drawString(img, face, cardText, line, left, y)
+		y += lineHeight
+	}
+
+	y = cardTextTop + cardTextHeight + 50
+	drawString(img, cardFace("bold", 30), cardText, "— "+card.Quotee.Name, left, y)
+	drawString(img, cardFace("regular", 22), cardMuted, card.Footer, left, y+40)
+
+	return encodePNG(img)
+}
+
+// fitText wraps text to width in the largest italic face whose lines fit in height. Text too long even at
+// cardMinText is cut short with an ellipsis.
+func fitText(text string, width, height int) (font.Face, []string) {
+	for size := cardMaxText; ; size -= 2 {
+		face := cardFace("italic", float64(size))
+		lines := wrapText(face, text, width)
+		fit := height / face.Metrics().Height.Ceil()
+		if len(lines) <= fit {
+			return face, lines
+		}
+		if size <= cardMinText {
+			lines = lines[:fit]
+			lines[fit-1] = ellipsize(face, lines[fit-1], width)
+			return face, lines
+		}
+	}
+}
+
+// wrapText breaks text into lines no wider than width, at spaces where it can and within words longer than a line.
+// Line breaks in the text are kept.
+func wrapText(face font.Face, text string, width int) []string {
+	limit := fixed.I(width)
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if font.MeasureString(face, candidate) <= limit {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// split words that do not fit on a line of their own
+			for font.MeasureString(face, word) > limit {
+				cut := len([]rune(word)) - 1
+				for cut > 1 && font.MeasureString(face, string([]rune(word)[:cut])) > limit {
+					cut--
+				}
+				lines = append(lines, string([]rune(word)[:cut]))
+				word = string([]rune(word)[cut:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ellipsize ends line with an ellipsis, dropping as much of it as needed to stay within width
+func ellipsize(face font.Face, line string, width int) string {
+	runes := []rune(line)
+	for len(runes) > 0 && font.MeasureString(face, string(runes)+"…") > fixed.I(width) {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimRight(string(runes), " ") + "…"
+}
+
+// drawString draws s with its baseline starting at x, y
+func drawString(img draw.Image, face font.Face, c color.Color, s string, x, y int) {
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+// drawAvatar draws the user's avatar, or their initial, clipped to a circle filling r
+func drawAvatar(img draw.Image, r image.Rectangle, u cardUser) {
+	mask := circle{r}
+	if u.Avatar == nil {
+		draw.DrawMask(img, r, image.NewUniform(cardAccent), image.Point{}, mask, r.Min, draw.Over)
+		initial := "?"
+		if name := []rune(u.Name); len(name) > 0 {
+			initial = strings.ToUpper(string(name[0]))
+		}
+		face := cardFace("bold", float64(r.Dy())/2)
+		x := r.Min.X + (r.Dx()-font.MeasureString(face, initial).Ceil())/2
+		y := r.Min.Y + (r.Dy()+face.Metrics().CapHeight.Ceil())/2
+		drawString(img, face, cardText, initial, x, y)
+		return
+	}
+
+	scaled := image.NewRGBA(r)
+	xdraw.CatmullRom.Scale(scaled, r, u.Avatar, u.Avatar.Bounds(), draw.Src, nil)
+	draw.DrawMask(img, r, scaled, r.Min, mask, r.Min, draw.Over)
+}
+
+// circle is an alpha mask of the largest circle inside a rectangle
+type circle struct {
+	r image.Rectangle
+}
+
+func (c circle) ColorModel() color.Model { return color.AlphaModel }
+
+func (c circle) Bounds() image.Rectangle { return c.r }
+
+func (c circle) At(x, y int) color.Color {
+	// compare squared distances from the center in half pixels, so even sizes stay symmetric
+	radius := c.r.Dx()
+	dx, dy := 2*(x-c.r.Min.X)+1-c.r.Dx(), 2*(y-c.r.Min.Y)+1-c.r.Dy()
+	if dx*dx+dy*dy <= radius*radius {
+		return color.Alpha{A: 0xff}
+	}
+	return color.Alpha{}
+}
+
+// discordUsers returns a lookup of the name and avatar users show with, as cards need them
+func discordUsers(s *discordgo.Session) func(ctx context.Context, id string) (cardUser, error) {
+	return func(ctx context.Context, id string) (cardUser, error) {
+		u, err := s.User(id, discordgo.WithContext(ctx))
+		if err != nil {
+			return cardUser{}, fmt.Errorf("discordUsers: %w", err)
+		}
+		user := cardUser{Name: u.GlobalName}
+		if user.Name == "" {
+			user.Name = u.Username
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.AvatarURL("256"), nil)
+		if err != nil {
+			return user, fmt.Errorf("discordUsers: %w", err)
+		}
+		resp, err := s.Client.Do(req)
+		if err != nil {
+			return user, fmt.Errorf("discordUsers: avatar: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return user, fmt.Errorf("discordUsers: avatar: %s", resp.Status)
+		}
+		if user.Avatar, _, err = image.Decode(resp.Body); err != nil {
+			return user, fmt.Errorf("discordUsers: avatar: %w", err)
+		}
+		return user, nil
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/image/font"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testAvatar is a gradient, so scaling and clipping it shows up in the golden files
+func testAvatar() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := range 64 {
+		for x := range 64 {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), 0xc0, 0xff})
+		}
+	}
+	return img
+}
+
+func TestRenderCard(t *testing.T) {
+	tests := []struct {
+		golden string
+		card   quoteCard
+	}{
+		{"card-avatar.png", quoteCard{Text: "the cake is a lie", Quotee: cardUser{Name: "GLaDOS", Avatar: testAvatar()}, Footer: "#1 · 10 Oct 07 12:00 UTC"}},
+		{"card-initial.png", quoteCard{Text: "line one\nline two", Quotee: cardUser{Name: "wheatley"}, Footer: "#2 · 19 Apr 11 09:30 UTC"}},
+		{"card-long.png", quoteCard{Text: strings.Repeat("so much to say about nothing at all ", 40) + strings.Repeat("x", 80), Quotee: cardUser{Name: "Cave Johnson"}, Footer: "#3 · 01 Jan 80 00:00 UTC"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := renderCard(tt.card)
+			if err != nil {
+				t.Fatalf("renderCard: %v", err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				failed := filepath.Join(t.TempDir(), tt.golden)
+				os.WriteFile(failed, got, 0o644)
+				t.Errorf("card differs from %s, see %s", path, failed)
+			}
+		})
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	face := cardFace("italic", 20)
+	width := font.MeasureString(face, "the cake is").Ceil()
+
+	lines := wrapText(face, "the cake is a lie\n\nabcdefghijklmnopqrstuvwxyz", width)
+	if len(lines) < 5 || lines[0] != "the cake is" || lines[1] != "a lie" || lines[2] != "" {
+		t.Fatalf("lines = %q", lines)
+	}
+	if got := strings.Join(lines[3:], ""); got != "abcdefghijklmnopqrstuvwxyz" {
+		t.Errorf("split word = %q", lines[3:])
+	}
+	for _, line := range lines {
+		if font.MeasureString(face, line).Ceil() > width {
+			t.Errorf("line %q is wider than %d", line, width)
+		}
+	}
+}
+
+func TestNewQuoteCard(t *testing.T) {
+	q := Quote{ID: 7, Quote: "hello", Quotee: "<@1>", CreatedAt: time.Date(2024, time.March, 5, 12, 0, 0, 0, time.UTC)}
+	card := newQuoteCard(q, cardUser{Name: "someone"})
+	if card.Text != "hello" || card.Quotee.Name != "someone" || card.Footer != "#7 · "+quoteTime(q) {
+		t.Errorf("card = %+v", card)
+	}
+}
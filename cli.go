@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// cliCommands are the modes the binary can run in instead of the bot, selected by its first argument
+var cliCommands = map[string]func(args []string) error{
+	"export": runExport,
+	"import": runImport,
+}
+
+// runCLI runs the command named by args[0] against the configured database
+func runCLI(args []string) error {
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(cliCommands))
+		for name := range cliCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q, expected one of: %s", args[0], strings.Join(names, ", "))
+	}
+
+	requireEnv(dbEnv()...)
+	return cmd(args[1:])
+}
+
+// runExport writes the collection to a file or standard output
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", string(formatJSON), "export format: json, csv or sql")
+	guild := fs.String("guild", "", "only export quotes from this guild ID (default every guild)")
+	out := fs.String("out", "", "file to write (default standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := openStore()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := ctxWithTimeout()
+	defer cancel()
+
+	quotes, err := db.listQuotes(ctx, *guild)
+	if err != nil {
+		return fmt.Errorf("error listing quotes: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	table, d := storeTarget()
+	if err := writeExport(w, exportFormat(*format), quotes, table, d); err != nil {
+		return fmt.Errorf("error writing export: %w", err)
+	}
+
+	slog.Info("exported quotes", "count", len(quotes), "format", *format)
+	return nil
+}
+
+// runImport reads a JSON or CSV file into the collection and prints a summary
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "import format: json or csv (default from the file extension)")
+	guild := fs.String("guild", "", "assign every quote to this guild ID (default the guild column of each row)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [-format json|csv] [-guild id] <file>")
+	}
+
+	name := fs.Arg(0)
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fileFormat := exportFormat(*format)
+	if fileFormat == "" {
+		if fileFormat, err = importFormatFromName(name); err != nil {
+			return err
+		}
+	}
+
+	rows, err := readImport(f, fileFormat)
+	if err != nil {
+		return err
+	}
+
+	db, err := openStore()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the database: %w", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	summary, err := importQuotes(ctx, db, rows, *guild)
+	fmt.Println(summary)
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	// containers often ship without a zoneinfo database, so embed one for DAILY_QUOTE_TZ
+	_ "time/tzdata"
+)
+
+// dailyTitle is the title of every quote of the day embed
+const dailyTitle = "Quote of the Day"
+
+// dailySchedule is when and where the quote of the day is posted
+type dailySchedule struct {
+	Hour     int
+	Minute   int
+	Location *time.Location
+	Channels []string
+}
+
+// loadDailySchedule reads the schedule from DAILY_QUOTE_CHANNELS, DAILY_QUOTE_TIME and DAILY_QUOTE_TZ. No channels
+// means no quote of the day is posted.
+func loadDailySchedule() (dailySchedule, error) {
+	var sched dailySchedule
+	for _, channel := range strings.Split(os.Getenv("DAILY_QUOTE_CHANNELS"), ",") {
+		if channel = strings.TrimSpace(channel); channel != "" {
+			sched.Channels = append(sched.Channels, channel)
+		}
+	}
+
+	at := os.Getenv("DAILY_QUOTE_TIME")
+	if at == "" {
+		at = "09:00"
+	}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return sched, fmt.Errorf("DAILY_QUOTE_TIME must be HH:MM: %w", err)
+	}
+	sched.Hour, sched.Minute = t.Hour(), t.Minute()
+
+	sched.Location, err = dailyLocation()
+	return sched, err
+}
+
+// dailyLocation returns the time zone that decides when a day starts, from DAILY_QUOTE_TZ or the local zone
+func dailyLocation() (*time.Location, error) {
+	tz := os.Getenv("DAILY_QUOTE_TZ")
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Local, fmt.Errorf("DAILY_QUOTE_TZ: %w", err)
+	}
+	return loc, nil
+}
+
+// dailyKey is the calendar date a pick is recorded under
+func dailyKey(day time.Time) string {
+	return day.Format(time.DateOnly)
+}
+
+// dailySeed picks the position of the quote of the day among the quotes left in the cycle, so every store picks the
+// same quote for the same date
+func dailySeed(guild string, key string, cycle int) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%s:%d", guild, key, cycle)
+	return h.Sum64()
+}
+
+// nextRun returns the first hour:minute strictly after now, in now's location
+func nextRun(now time.Time, hour int, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(now.Year(), now.Month(), now.Day()+1, hour, minute, 0, 0, now.Location())
+	}
+	return next
+}
+
+// runDailyQuotes posts the quote of the day to every scheduled channel each day until ctx is cancelled
+func runDailyQuotes(ctx context.Context, s *discordgo.Session, db QuoteStore, sched dailySchedule) {
+	for {
+		next := nextRun(time.Now().In(sched.Location), sched.Hour, sched.Minute)
+		slog.InfoContext(ctx, "scheduled quote of the day", "at", next)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, channel := range sched.Channels {
+			if err := postDailyQuote(ctx, s, db, channel, next); err != nil {
+				slog.ErrorContext(ctx, "error posting quote of the day", "channel", channel, "err", err)
+			}
+		}
+	}
+}
+
+// postDailyQuote posts the quote of the day for the guild that owns channel
+func postDailyQuote(ctx context.Context, s *discordgo.Session, db QuoteStore, channel string, day time.Time) error {
+	ch, err := s.State.Channel(channel)
+	if err != nil {
+		ch, err = s.Channel(channel)
+		if err != nil {
+			return fmt.Errorf("error looking up channel: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(withLogAttrs(ctx, slog.String("guild", ch.GuildID), slog.String("channel", channel)), dbTimeout)
+	defer cancel()
+
+	quote, err := db.getDailyQuote(ctx, ch.GuildID, day)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.InfoContext(ctx, "no quotes for the quote of the day")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.ChannelMessageSendEmbed(channel, quoteEmbed(dailyTitle, quote))
+	return err
+}
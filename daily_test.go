@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	loc := time.FixedZone("test", -5*60*60)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"later today", time.Date(2024, 3, 1, 8, 0, 0, 0, loc), time.Date(2024, 3, 1, 9, 0, 0, 0, loc)},
+		{"exactly now", time.Date(2024, 3, 1, 9, 0, 0, 0, loc), time.Date(2024, 3, 2, 9, 0, 0, 0, loc)},
+		{"already passed", time.Date(2024, 3, 1, 21, 30, 0, 0, loc), time.Date(2024, 3, 2, 9, 0, 0, 0, loc)},
+		{"end of month", time.Date(2024, 2, 29, 10, 0, 0, 0, loc), time.Date(2024, 3, 1, 9, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRun(tt.now, 9, 0); !got.Equal(tt.want) {
+				t.Errorf("nextRun(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDailySchedule(t *testing.T) {
+	t.Setenv("DAILY_QUOTE_CHANNELS", "1, 2,,")
+	t.Setenv("DAILY_QUOTE_TIME", "18:45")
+	t.Setenv("DAILY_QUOTE_TZ", "America/Chicago")
+
+	sched, err := loadDailySchedule()
+	if err != nil {
+		t.Fatalf("loadDailySchedule: %v", err)
+	}
+	if len(sched.Channels) != 2 || sched.Channels[0] != "1" || sched.Channels[1] != "2" {
+		t.Errorf("channels = %q, want [1 2]", sched.Channels)
+	}
+	if sched.Hour != 18 || sched.Minute != 45 {
+		t.Errorf("time = %02d:%02d, want 18:45", sched.Hour, sched.Minute)
+	}
+	if sched.Location.String() != "America/Chicago" {
+		t.Errorf("location = %v, want America/Chicago", sched.Location)
+	}
+
+	t.Setenv("DAILY_QUOTE_TIME", "9am")
+	if _, err := loadDailySchedule(); err == nil {
+		t.Error("expected an error for a malformed DAILY_QUOTE_TIME")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dialect identifies the flavour of SQL spoken by the database behind a SQLConn
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+// driverName returns the database/sql driver registered for the dialect
+func (d dialect) driverName() string {
+	if d == dialectPostgres {
+		return "pgx"
+	}
+	return "sqlite3"
+}
+
+// migrations returns the ordered schema migrations for the dialect
+func (d dialect) migrations() []migration {
+	if d == dialectPostgres {
+		return postgresMigrations
+	}
+	return sqliteMigrations
+}
+
+// rebind rewrites the ? placeholders in query into the dialect's bind variable syntax
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// likeOp returns the case-insensitive pattern match operator. SQLite's LIKE already ignores case for ASCII.
+func (d dialect) likeOp() string {
+	if d == dialectPostgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// timeValue wraps a timestamp column or bind variable so it compares by instant. SQLite stores times as text in the
+// offset they were written in, which only orders correctly once converted.
+func (d dialect) timeValue(expr string) string {
+	if d == dialectPostgres {
+		return expr
+	}
+	return "julianday(" + expr + ")"
+}
+
+// intervalStart returns the first day of the UTC week or month a timestamp column falls in, as a date such as
+// 2024-01-29. Weeks start on Monday.
+func (d dialect) intervalStart(expr string, iv statsInterval) string {
+	if d == dialectPostgres {
+		return fmt.Sprintf("to_char(date_trunc('%s', %s AT TIME ZONE 'UTC'), 'YYYY-MM-DD')", iv, expr)
+	}
+	if iv == statsWeek {
+		// step back six days, then forward to the first Monday, which is the day itself when it is a Monday
+		return fmt.Sprintf("date(%s, '-6 days', 'weekday 1')", expr)
+	}
+	return fmt.Sprintf("date(%s, 'start of month')", expr)
+}
+
+// sqlString quotes s as a SQL string literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
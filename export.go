@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFormat is a file format the collection can be exported to
+type exportFormat string
+
+const (
+	formatJSON exportFormat = "json"
+	formatCSV  exportFormat = "csv"
+	formatSQL  exportFormat = "sql"
+)
+
+// contentType returns the MIME type of an export format
+func (f exportFormat) contentType() string {
+	switch f {
+	case formatCSV:
+		return "text/csv"
+	case formatSQL:
+		return "application/sql"
+	default:
+		return "application/json"
+	}
+}
+
+// quoteRecord is the exported shape of a quote. Field names are part of the export format, so they must not change.
+type quoteRecord struct {
+	ID        int64     `json:"id"`
+	Guild     string    `json:"guild"`
+	Quote     string    `json:"quote"`
+	Quotee    string    `json:"quotee"`
+	Quoter    string    `json:"quoter"`
+	CreatedAt time.Time `json:"createdAt"`
+	ChannelID string    `json:"channelID"`
+	MessageID string    `json:"messageID"`
+	Tags      []string  `json:"tags"`
+}
+
+// csvHeader is the header row of a CSV export, in the order of quoteRecord
+var csvHeader = []string{"id", "guild", "quote", "quotee", "quoter", "createdAt", "channelID", "messageID", "tags"}
+
+// newQuoteRecord converts a quote to its exported shape. Untagged quotes get an empty list of tags rather than null.
+func newQuoteRecord(q Quote) quoteRecord {
+	tags := q.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return quoteRecord{
+		ID:        q.ID,
+		Guild:     q.GuildID,
+		Quote:     q.Quote,
+		Quotee:    q.Quotee,
+		Quoter:    q.Quoter,
+		CreatedAt: q.CreatedAt.UTC(),
+		ChannelID: q.ChannelID,
+		MessageID: q.MessageID,
+		Tags:      tags,
+	}
+}
+
+// writeExport writes quotes to w in the given format. A SQL dump inserts into table using the syntax of d.
+func writeExport(w io.Writer, format exportFormat, quotes []Quote, table string, d dialect) error {
+	switch format {
+	case formatJSON:
+		return writeJSONExport(w, quotes)
+	case formatCSV:
+		return writeCSVExport(w, quotes)
+	case formatSQL:
+		return writeSQLExport(w, quotes, table, d)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// writeJSONExport writes quotes as an indented JSON array
+func writeJSONExport(w io.Writer, quotes []Quote) error {
+	records := make([]quoteRecord, 0, len(quotes))
+	for _, q := range quotes {
+		records = append(records, newQuoteRecord(q))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// writeCSVExport writes quotes as CSV with a header row
+func writeCSVExport(w io.Writer, quotes []Quote) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, q := range quotes {
+		r := newQuoteRecord(q)
+		row := []string{
+			strconv.FormatInt(r.ID, 10),
+			r.Guild,
+			r.Quote,
+			r.Quotee,
+			r.Quoter,
+			r.CreatedAt.Format(time.RFC3339Nano),
+			r.ChannelID,
+			r.MessageID,
+			strings.Join(r.Tags, ","),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeSQLExport writes quotes and their tags as INSERT statements wrapped in a transaction, to be replayed into a
+// migrated database of the given dialect. Tags keep their names but are numbered afresh.
+func writeSQLExport(w io.Writer, quotes []Quote, table string, d dialect) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "BEGIN;")
+	for _, q := range quotes {
+		r := newQuoteRecord(q)
+		fmt.Fprintf(bw, "INSERT INTO %s (id, guild, quote, quotee, quoter, createdAt, channelID, messageID) VALUES (%d, %s, %s, %s, %s, %s, %s, %s);\n",
+			table, r.ID, sqlString(r.Guild), sqlString(r.Quote), sqlString(r.Quotee), sqlString(r.Quoter),
+			sqlString(r.CreatedAt.Format(time.RFC3339Nano)), sqlString(r.ChannelID), sqlString(r.MessageID))
+		for _, tag := range r.Tags {
+			fmt.Fprintf(bw, "INSERT INTO %s (guild, name) VALUES (%s, %s) ON CONFLICT DO NOTHING;\n",
+				tagsTable(table), sqlString(r.Guild), sqlString(tag))
+			fmt.Fprintf(bw, "INSERT INTO %s (quoteID, tagID) SELECT %d, id FROM %s WHERE guild = %s AND name = %s;\n",
+				quoteTagsTable(table), r.ID, tagsTable(table), sqlString(r.Guild), sqlString(tag))
+		}
+	}
+	if d == dialectPostgres {
+		// explicit IDs don't advance the serial sequence, so move it past the imported rows
+		fmt.Fprintf(bw, "SELECT setval(pg_get_serial_sequence(%s, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s;\n", sqlString(table), table)
+	}
+	fmt.Fprintln(bw, "COMMIT;")
+	return bw.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportFixture() []Quote {
+	return []Quote{
+		{ID: 7, Quote: "it's a \"quote\", with commas", Quotee: "<@1>", Quoter: "<@2>",
+			CreatedAt: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), GuildID: testGuild, Tags: []string{"funny", "in-jokes"}},
+		{ID: 9, Quote: "line one\nline two", Quotee: "<@3>", Quoter: "<@1>",
+			CreatedAt: time.Date(2024, 3, 2, 8, 0, 0, 500, time.UTC), GuildID: testGuild, ChannelID: "20", MessageID: "30", Tags: []string{"in-jokes"}},
+		{ID: 11, Quote: "untagged", Quotee: "<@2>", Quoter: "<@3>",
+			CreatedAt: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), GuildID: testGuild},
+	}
+}
+
+// assertSameQuotes fails unless got and want hold the same quotes, comparing timestamps as instants
+func assertSameQuotes(t *testing.T, got, want []Quote) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d quotes, want %d", len(got), len(want))
+	}
+	for x := range want {
+		g, w := got[x], want[x]
+		if !g.CreatedAt.Equal(w.CreatedAt) {
+			t.Errorf("quote %d CreatedAt = %v, want %v", x, g.CreatedAt, w.CreatedAt)
+		}
+		g.CreatedAt, w.CreatedAt = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("quote %d = %+v, want %+v", x, g, w)
+		}
+	}
+}
+
+func TestWriteJSONExport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeExport(&buf, formatJSON, exportFixture(), "quotes", dialectSQLite); err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+
+	var records []quoteRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(records) != 3 || records[1].ID != 9 || records[1].MessageID != "30" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+	if !strings.Contains(buf.String(), `"tags": [
+      "funny",
+      "in-jokes"
+    ]`) || !strings.Contains(buf.String(), `"tags": []`) {
+		t.Errorf("expected tags as arrays, empty for untagged quotes, got:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"createdAt": "2024-03-01T12:30:00Z"`) {
+		t.Errorf("expected RFC 3339 timestamps, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteCSVExport(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeExport(&buf, formatCSV, exportFixture(), "quotes", dialectSQLite); err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected header and 3 rows, got %d", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("header = %v", rows[0])
+	}
+	if rows[1][0] != "7" || rows[1][2] != `it's a "quote", with commas` || rows[1][8] != "funny,in-jokes" {
+		t.Errorf("first row = %v", rows[1])
+	}
+	if rows[3][8] != "" {
+		t.Errorf("tags of an untagged quote = %q", rows[3][8])
+	}
+}
+
+func TestSQLExportRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeExport(&buf, formatSQL, exportFixture(), "quotes", dialectSQLite); err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+
+	conn := newTestDB(t)
+	if _, err := conn.Conn.Exec(buf.String()); err != nil {
+		t.Fatalf("replay dump: %v\n%s", err, buf.String())
+	}
+
+	quotes, err := conn.listQuotes(context.Background(), testGuild)
+	if err != nil {
+		t.Fatalf("listQuotes: %v", err)
+	}
+	assertSameQuotes(t, quotes, exportFixture())
+
+	tags, err := conn.listTags(context.Background(), testGuild)
+	if err != nil {
+		t.Fatalf("listTags: %v", err)
+	}
+	if len(tags) != 2 || tags[0] != (tagCount{Name: "in-jokes", Count: 2}) || tags[1] != (tagCount{Name: "funny", Count: 1}) {
+		t.Errorf("listTags = %+v, want in-jokes on 2 quotes and funny on 1", tags)
+	}
+}
+
+func TestWriteExportUnknownFormat(t *testing.T) {
+	if err := writeExport(&bytes.Buffer{}, "xml", nil, "quotes", dialectSQLite); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
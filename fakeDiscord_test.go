@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	fakeAppID = "900000000000000001"
+	fakeBotID = "900000000000000002"
+
+	// fakeWait is how long the fake waits for the bot to do something
+	fakeWait = 30 * time.Second
+)
+
+// fakeAvatarColor fills the avatar of every user
+var fakeAvatarColor = color.RGBA{0xff, 0x80, 0x00, 0xff}
+
+// fakeDiscord is a local stand-in for Discord's REST API and gateway. It accepts command registration, delivers
+// scripted events to the connected session and records every reply to an interaction as a fakeCall, keyed by the
+// interaction's token.
+type fakeDiscord struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	changed  *sync.Cond
+	commands map[string][]*discordgo.ApplicationCommand // by guild, "" for global commands
+	calls    map[string][]fakeCall
+	conn     *websocket.Conn
+	seq      int
+	exited   bool
+	exitErr  error
+}
+
+// newFakeDiscord starts a fake Discord that is shut down when the test ends
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	t.Helper()
+	f := &fakeDiscord{
+		t:        t,
+		commands: make(map[string][]*discordgo.ApplicationCommand),
+		calls:    make(map[string][]fakeCall),
+	}
+	f.changed = sync.NewCond(&f.mu)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/{version}/gateway", f.gatewayURL)
+	mux.HandleFunc("GET /gateway/", f.gateway)
+	mux.HandleFunc("PUT /api/{version}/applications/{app}/commands", f.overwriteCommands)
+	mux.HandleFunc("PUT /api/{version}/applications/{app}/guilds/{guild}/commands", f.overwriteCommands)
+	mux.HandleFunc("POST /api/{version}/interactions/{id}/{token}/callback", f.interactionCallback)
+	mux.HandleFunc("PATCH /api/{version}/webhooks/{app}/{token}/messages/@original", f.editResponse)
+	mux.HandleFunc("DELETE /api/{version}/webhooks/{app}/{token}/messages/@original", f.deleteResponse)
+	mux.HandleFunc("POST /api/{version}/webhooks/{app}/{token}", f.followup)
+	mux.HandleFunc("GET /api/{version}/users/{id}", f.user)
+	mux.HandleFunc("GET /avatars/{id}/{file}", f.avatar)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		f.t.Errorf("fake Discord: unexpected request %s %s", r.Method, r.URL.Path)
+		http.Error(w, `{"message": "404: Not Found", "code": 0}`, http.StatusNotFound)
+	})
+
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.close)
+	return f
+}
+
+// URL is the base URL to set as DISCORD_API_URL
+func (f *fakeDiscord) URL() string {
+	return f.srv.URL
+}
+
+func (f *fakeDiscord) close() {
+	f.mu.Lock()
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	f.mu.Unlock()
+	f.srv.Close()
+}
+
+// gatewayURL points the session at the fake gateway
+func (f *fakeDiscord) gatewayURL(w http.ResponseWriter, r *http.Request) {
+	writeFakeJSON(w, map[string]string{"url": "ws" + strings.TrimPrefix(f.srv.URL, "http") + "/gateway"})
+}
+
+// gateway says hello, waits for the session to identify, reports it ready and then acknowledges heartbeats until
+// the session disconnects. Events are written by dispatch.
+func (f *fakeDiscord) gateway(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Errorf("fake Discord: upgrading the gateway: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	f.send(conn, map[string]any{"op": 10, "d": map[string]any{"heartbeat_interval": 45000}})
+	var identify struct {
+		Op int `json:"op"`
+	}
+	if err := conn.ReadJSON(&identify); err != nil || identify.Op != 2 {
+		f.t.Errorf("fake Discord: expected identify, got op %d: %v", identify.Op, err)
+		return
+	}
+
+	f.mu.Lock()
+	f.conn = conn
+	f.mu.Unlock()
+	f.dispatch("READY", discordgo.Ready{
+		Version:     10,
+		SessionID:   "fake-session",
+		User:        &discordgo.User{ID: fakeBotID, Username: "Tiltbot", Discriminator: "0", Bot: true},
+		Application: &discordgo.Application{ID: fakeAppID},
+		Guilds:      []*discordgo.Guild{},
+	})
+
+	for {
+		var p struct {
+			Op int `json:"op"`
+		}
+		if err := conn.ReadJSON(&p); err != nil {
+			f.mu.Lock()
+			f.conn = nil
+			f.mu.Unlock()
+			return
+		}
+		if p.Op == 1 {
+			f.send(conn, map[string]any{"op": 11})
+		}
+	}
+}
+
+// send writes one gateway payload
+func (f *fakeDiscord) send(conn *websocket.Conn, payload any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := conn.WriteJSON(payload); err != nil {
+		f.t.Errorf("fake Discord: writing to the gateway: %v", err)
+	}
+}
+
+// dispatch sends an event to the connected session
+func (f *fakeDiscord) dispatch(event string, data any) {
+	f.mu.Lock()
+	conn := f.conn
+	f.seq++
+	seq := f.seq
+	f.mu.Unlock()
+	if conn == nil {
+		f.t.Fatalf("fake Discord: no session is connected to receive %s", event)
+	}
+	f.send(conn, map[string]any{"op": 0, "t": event, "s": seq, "d": data})
+}
+
+// interact delivers an interaction to the bot, filling in the IDs a real one carries, and returns its token
+func (f *fakeDiscord) interact(i *discordgo.Interaction) string {
+	i.AppID = fakeAppID
+	i.Token = "token-" + i.ID
+	i.Version = 1
+	f.dispatch("INTERACTION_CREATE", i)
+	return i.Token
+}
+
+// waitCommands waits until the commands of a guild, or global commands for "", are overwritten and returns them
+func (f *fakeDiscord) waitCommands(guild string) []*discordgo.ApplicationCommand {
+	f.t.Helper()
+	var cmds []*discordgo.ApplicationCommand
+	f.wait("command registration", func() bool {
+		var ok bool
+		cmds, ok = f.commands[guild]
+		return ok
+	})
+	return cmds
+}
+
+// waitCalls waits until the interaction with the given token has n recorded calls and returns them
+func (f *fakeDiscord) waitCalls(token string, n int) []fakeCall {
+	f.t.Helper()
+	var calls []fakeCall
+	f.wait(fmt.Sprintf("%d replies to %s", n, token), func() bool {
+		calls = f.calls[token]
+		return len(calls) >= n
+	})
+	return calls
+}
+
+// start runs the bot in the background. Waiting fails the test if the bot exits early. The returned function stops
+// the bot and returns the error it exited with.
+func (f *fakeDiscord) start(run func(context.Context) error) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		err := run(ctx)
+		f.mu.Lock()
+		f.exited, f.exitErr = true, err
+		f.changed.Broadcast()
+		f.mu.Unlock()
+	}()
+
+	stop := func() error {
+		cancel()
+		select {
+		case <-exited:
+		case <-time.After(fakeWait):
+			f.t.Fatal("fake Discord: the bot did not stop")
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.exitErr
+	}
+	f.t.Cleanup(func() { stop() })
+	return stop
+}
+
+// wait blocks until done reports true, checking it with the lock held every time the fake records something
+func (f *fakeDiscord) wait(what string, done func() bool) {
+	f.t.Helper()
+	timeout := time.AfterFunc(fakeWait, func() {
+		f.mu.Lock()
+		f.changed.Broadcast()
+		f.mu.Unlock()
+	})
+	defer timeout.Stop()
+	deadline := time.Now().Add(fakeWait)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for !done() {
+		if f.exited {
+			f.t.Fatalf("fake Discord: the bot exited while waiting for %s: %v", what, f.exitErr)
+		}
+		if time.Now().After(deadline) {
+			f.t.Fatalf("fake Discord: timed out waiting for %s", what)
+		}
+		f.changed.Wait()
+	}
+}
+
+func (f *fakeDiscord) record(token string, c fakeCall) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[token] = append(f.calls[token], c)
+	f.changed.Broadcast()
+}
+
+func (f *fakeDiscord) overwriteCommands(w http.ResponseWriter, r *http.Request) {
+	var cmds []*discordgo.ApplicationCommand
+	if !f.decode(w, r, &cmds, nil) {
+		return
+	}
+	for x, cmd := range cmds {
+		cmd.ID = fmt.Sprint(800000000000000000 + x)
+		cmd.ApplicationID = r.PathValue("app")
+	}
+
+	f.mu.Lock()
+	f.commands[r.PathValue("guild")] = cmds
+	f.changed.Broadcast()
+	f.mu.Unlock()
+	writeFakeJSON(w, cmds)
+}
+
+func (f *fakeDiscord) interactionCallback(w http.ResponseWriter, r *http.Request) {
+	var resp discordgo.InteractionResponse
+	var files []*discordgo.File
+	if !f.decode(w, r, &resp, &files) {
+		return
+	}
+	if resp.Data != nil {
+		resp.Data.Files = files
+	}
+	f.record(r.PathValue("token"), fakeCall{Method: "respond", Type: resp.Type, Data: resp.Data})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeDiscord) editResponse(w http.ResponseWriter, r *http.Request) {
+	var data discordgo.InteractionResponseData
+	if !f.decode(w, r, &data, &data.Files) {
+		return
+	}
+	f.record(r.PathValue("token"), fakeCall{Method: "edit", Data: &data})
+	writeFakeJSON(w, discordgo.Message{ID: "700000000000000001", Content: data.Content, Embeds: data.Embeds})
+}
+
+func (f *fakeDiscord) deleteResponse(w http.ResponseWriter, r *http.Request) {
+	f.record(r.PathValue("token"), fakeCall{Method: "delete"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeDiscord) followup(w http.ResponseWriter, r *http.Request) {
+	var data discordgo.InteractionResponseData
+	if !f.decode(w, r, &data, &data.Files) {
+		return
+	}
+	f.record(r.PathValue("token"), fakeCall{Method: "followup", Data: &data})
+	writeFakeJSON(w, discordgo.Message{ID: "700000000000000002", Content: data.Content, Embeds: data.Embeds})
+}
+
+// user describes any user, with an avatar served by avatar
+func (f *fakeDiscord) user(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	writeFakeJSON(w, discordgo.User{ID: id, Username: "user-" + id[:3], GlobalName: "User " + id[:3], Avatar: "fakeavatar"})
+}
+
+// avatar serves every user the same solid avatar
+func (f *fakeDiscord) avatar(w http.ResponseWriter, r *http.Request) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), image.NewUniform(fakeAvatarColor), image.Point{}, draw.Src)
+	w.Header().Set("Content-Type", "image/png")
+	if err := png.Encode(w, img); err != nil {
+		f.t.Errorf("fake Discord: encoding an avatar: %v", err)
+	}
+}
+
+// decode reads a JSON body into v, or a multipart body whose payload_json part goes into v and whose file parts go
+// into files. It answers with an error and returns false if the body is malformed.
+func (f *fakeDiscord) decode(w http.ResponseWriter, r *http.Request, v any, files *[]*discordgo.File) bool {
+	err := func() error {
+		mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "multipart/form-data" {
+			return json.NewDecoder(r.Body).Decode(v)
+		}
+
+		parts := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			p, err := parts.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			body, err := io.ReadAll(p)
+			if err != nil {
+				return err
+			}
+			if p.FormName() == "payload_json" {
+				if err := json.Unmarshal(body, v); err != nil {
+					return err
+				}
+			} else if files != nil {
+				*files = append(*files, &discordgo.File{
+					Name:        p.FileName(),
+					ContentType: p.Header.Get("Content-Type"),
+					Reader:      bytes.NewReader(body),
+				})
+			}
+		}
+	}()
+	if err != nil {
+		f.t.Errorf("fake Discord: decoding %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, `{"message": "Invalid Form Body", "code": 50035}`, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeFakeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
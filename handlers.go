@@ -1,170 +1,926 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// HandlerContext holds the dependencies shared by every handler
 type HandlerContext struct {
-	Session *discordgo.Session
-	DB      *SQLConn
+	Discord  Responder
+	DB       QuoteStore
+	Searches *SearchCache
+	// Limiter limits how often each user may run commands; nil allows any rate
+	Limiter *rateLimiter
+	// AlertOwner tells the bot owner about a problem that needs their attention, if set
+	AlertOwner func(ctx context.Context, msg string) error
+	// LookupUser finds the name and avatar a user shows with, if set; quote cards show an unknown user without it
+	LookupUser func(ctx context.Context, id string) (cardUser, error)
 }
 
-var quoteHandler = map[string]func(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption){
-	"count": func(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption) {
-		ctx, cancel := ctxWithTimeout()
-		defer cancel()
+type (
+	addOptions struct {
+		Quote  string          `option:"quote"`
+		Quotee *discordgo.User `option:"quotee"`
+		Tags   string          `option:"tags"`
+	}
+	// userOptions filters a subcommand to the quotes of one user
+	userOptions struct {
+		User *discordgo.User `option:"user"`
+	}
+	randomOptions struct {
+		User *discordgo.User `option:"user"`
+		Tag  string          `option:"tag"`
+	}
+	leaderboardOptions struct {
+		Period leaderboardPeriod `option:"period"`
+		Mode   leaderboardMode   `option:"mode"`
+		From   string            `option:"from"`
+		To     string            `option:"to"`
+	}
+	statsOptions struct {
+		User     *discordgo.User `option:"user"`
+		Interval statsInterval   `option:"interval"`
+	}
+	idOptions struct {
+		ID int64 `option:"id"`
+	}
+	editOptions struct {
+		ID    int64  `option:"id"`
+		Quote string `option:"quote"`
+		Tags  string `option:"tags"`
+	}
+	exportOptions struct {
+		Format exportFormat `option:"format"`
+	}
+	importOptions struct {
+		File *discordgo.MessageAttachment `option:"file"`
+	}
+	searchOptions struct {
+		Query string      `option:"query"`
+		Sort  searchOrder `option:"sort"`
+		Tag   string      `option:"tag"`
+	}
+)
 
-		count, err := c.DB.quoteCount(ctx)
-		if err != nil {
-			sendErr(c.Session, i, err)
-			return
-		}
-		sendMsg(c.Session, i, fmt.Sprintf("There are %d quotes in the collection", count))
+// quoteSubcommands declares every /quote subcommand in the order Discord lists them
+var quoteSubcommands = []subcommand{
+	typedSubcommand[addOptions]{
+		Name:        "add",
+		Description: "Add a quote to the collection",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "quote",
+				Description: "Quote to add",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "quotee",
+				Description: "Person who spoke the cursed quote",
+				Required:    true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "tags",
+				Description:  "Comma-separated tags to file the quote under",
+				Required:     false,
+				Autocomplete: true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts addOptions) {
+			tags, err := parseTags(opts.Tags)
+			if err != nil {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
+			t, err := discordgo.SnowflakeTimestamp(i.ID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			quoteSave := Quote{
+				Quote:     opts.Quote,
+				Quotee:    fmt.Sprintf("<@%v>", opts.Quotee.ID),
+				Quoter:    fmt.Sprintf("<@%v>", interactionUser(i)),
+				CreatedAt: t,
+				GuildID:   i.GuildID,
+				Tags:      tags,
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			quoteSave.ID, err = c.DB.createQuote(ctx, quoteSave)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := quoteEmbed("Added Quote", quoteSave)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
 	},
-	"add": func(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption) {
-		quote := o[0].Options[0].StringValue()
-		quotee := o[0].Options[1].UserValue(c.Session)
-		t, err := discordgo.SnowflakeTimestamp(i.ID)
-		if err != nil {
-			sendErr(c.Session, i, err)
-			return
-		}
-		quoteSave := Quote{
-			Quote:     quote,
-			Quotee:    fmt.Sprintf("<@%v>", quotee.ID),
-			Quoter:    fmt.Sprintf("<@%v>", i.Member.User.ID),
-			CreatedAt: t,
-		}
+	typedSubcommand[randomOptions]{
+		Name:        "random",
+		Description: "Get a random quote from the collection",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Get a random quote for a specific user",
+				Required:    false,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "tag",
+				Description:  "Only pick from quotes with this tag",
+				Required:     false,
+				Autocomplete: true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts randomOptions) {
+			tag, err := filterTag(opts.Tag)
+			if err != nil {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
 
-		ctx, cancel := ctxWithTimeout()
-		defer cancel()
+			var quote Quote
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
 
-		err = c.DB.createQuote(ctx, quoteSave)
-		if err != nil {
-			sendErr(c.Session, i, err)
-			return
-		}
-		e := generateEmbed("Added Quote", quoteFields(quoteSave))
-		sendEmbed(c.Session, i, []*discordgo.MessageEmbed{e})
+			// if the user is specified, get a random quote for that user
+			if opts.User != nil {
+				quote, err = c.DB.getRandUserQuote(ctx, i.GuildID, opts.User.ID, tag)
+				if errors.Is(err, sql.ErrNoRows) {
+					sendMsg(c.Discord, i, fmt.Sprintf("No quotes found for %s%s", opts.User.Username, taggedWith(tag)))
+					return
+				}
+			} else {
+				quote, err = c.DB.getRandQuote(ctx, i.GuildID, tag)
+				if errors.Is(err, sql.ErrNoRows) && tag != "" {
+					sendMsg(c.Discord, i, "No quotes found"+taggedWith(tag))
+					return
+				}
+			}
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := quoteEmbed("Random Quote", quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
 	},
-	"leaderboard": func(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption) {
-		ctx, cancel := ctxWithTimeout()
-		defer cancel()
+	typedSubcommand[userOptions]{
+		Name:        "latest",
+		Description: "Get the most recent quote from the collection",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Get the most recent quote for a specific user",
+				Required:    false,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts userOptions) {
+			var quote Quote
+			var err error
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
 
-		leaderboard, err := c.DB.getLeaderboard(ctx)
-		if err != nil {
-			sendErr(c.Session, i, err)
-			return
-		}
+			// if the user is specified, get the latest quote for that user
+			if opts.User != nil {
+				quote, err = c.DB.getLatestUserQuote(ctx, i.GuildID, opts.User.ID)
+				if errors.Is(err, sql.ErrNoRows) {
+					sendMsg(c.Discord, i, fmt.Sprintf("No quotes found for %s", opts.User.Username))
+					return
+				}
+			} else {
+				quote, err = c.DB.getLatestQuote(ctx, i.GuildID)
+			}
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := quoteEmbed("Latest Quote", quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[noOptions]{
+		Name:        "count",
+		Description: "Get the current number of quotes in the collection",
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, _ noOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
 
-		e := generateEmbed("Quote Leaderboard", []*discordgo.MessageEmbedField{
-			{Name: "All-time", Value: leaderboard},
-		})
-		sendEmbed(c.Session, i, []*discordgo.MessageEmbed{e})
+			count, err := c.DB.quoteCount(ctx, i.GuildID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			sendMsg(c.Discord, i, fmt.Sprintf("There are %d quotes in the collection", count))
+		},
 	},
-	"latest": func(c *HandlerContext, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
-		var quote Quote
-		var err error
-		ctx, cancel := ctxWithTimeout()
-		defer cancel()
+	typedSubcommand[leaderboardOptions]{
+		Name:        "leaderboard",
+		Description: "Get the leaderboard of users with the most quotes",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "period",
+				Description: "Time to count quotes over (defaults to all-time)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Past week", Value: string(periodWeek)},
+					{Name: "Past month", Value: string(periodMonth)},
+					{Name: "Past year", Value: string(periodYear)},
+					{Name: "All-time", Value: string(periodAllTime)},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "Who to rank (defaults to quotees)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Quotees, who said the most quotes", Value: string(rankQuotees)},
+					{Name: "Quoters, who added the most quotes", Value: string(rankQuoters)},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "from",
+				Description: "First day of a custom range, such as 2024-01-31",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "to",
+				Description: "Last day of a custom range, such as 2024-12-31",
+				Required:    false,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts leaderboardOptions) {
+			lq, err := newLeaderboardQuery(opts.Mode, opts.Period, opts.From, opts.To, time.Now(), time.Local)
+			if err != nil {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
 
-		// if the user is specified, get the latest quote for that user
-		if len(options[0].Options) != 0 {
-			quotee := options[0].Options[0].UserValue(c.Session)
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
 
-			quote, err = c.DB.getLatestUserQuote(ctx, quotee.ID)
-			if err == sql.ErrNoRows {
-				sendMsg(c.Session, i, fmt.Sprintf("No quotes found for %s", quotee.Username))
+			leaderboard, err := c.DB.getLeaderboard(ctx, i.GuildID, lq)
+			if err != nil {
+				sendErr(c.Discord, i, err)
 				return
 			}
+			own, rank, err := c.DB.getLeaderboardRank(ctx, i.GuildID, lq, interactionUser(i))
 			if err != nil {
-				sendErr(c.Session, i, err)
-				log.Printf("Error getting latest user quote: %v", err)
+				sendErr(c.Discord, i, err)
 				return
 			}
-		} else {
-			quote, err = c.DB.getLatestQuote(ctx)
+
+			ranks := formatLeaderboard(leaderboard)
+			if ranks == "" {
+				ranks = "No quotes in this period"
+			}
+			yours := "You have no quotes in this period"
+			if rank > 0 {
+				yours = formatRank(rank, own)
+			}
+
+			title := "Quote Leaderboard"
+			if lq.Mode == rankQuoters {
+				title = "Quoter Leaderboard"
+			}
+			e := generateEmbed(title, []*discordgo.MessageEmbedField{
+				{Name: lq.Label, Value: ranks},
+				{Name: "Your Rank", Value: yours},
+			})
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[userOptions]{
+		Name:        "profile",
+		Description: "Get the quote stats of a user",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "User to get the stats of (defaults to you)",
+				Required:    false,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts userOptions) {
+			user, name := interactionUser(i), "you"
+			if opts.User != nil {
+				user, name = opts.User.ID, opts.User.Username
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			profile, err := c.DB.getProfile(ctx, i.GuildID, user)
 			if err != nil {
-				sendErr(c.Session, i, err)
-				log.Printf("Error getting latest quote: %v", err)
+				sendErr(c.Discord, i, err)
 				return
 			}
-		}
-		e := generateEmbed("Latest Quote", quoteFields(quote))
-		sendEmbed(c.Session, i, []*discordgo.MessageEmbed{e})
+			if profile.QuoteeRank == 0 && profile.QuoterRank == 0 {
+				sendMsg(c.Discord, i, fmt.Sprintf("No quotes found for %s", name))
+				return
+			}
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{profileEmbed(user, profile)})
+		},
 	},
-	"random": func(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption) {
-		var quote Quote
-		var err error
-		ctx, cancel := ctxWithTimeout()
-		defer cancel()
+	typedSubcommand[statsOptions]{
+		Name:        "stats",
+		Description: "Get a chart of how many quotes were added over time",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Chart the quotes of a specific user",
+				Required:    false,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "interval",
+				Description: "Time each bar counts quotes over (defaults to month)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Week", Value: string(statsWeek)},
+					{Name: "Month", Value: string(statsMonth)},
+				},
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts statsOptions) {
+			if opts.Interval == "" {
+				opts.Interval = statsMonth
+			}
+			var quotee, title string
+			if opts.User != nil {
+				quotee, title = opts.User.ID, fmt.Sprintf("Quotes of %s per %s", opts.User.Username, opts.Interval)
+			} else {
+				title = fmt.Sprintf("Quotes per %s", opts.Interval)
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			counts, err := c.DB.getActivity(ctx, i.GuildID, quotee, opts.Interval)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			if len(counts) == 0 {
+				if opts.User != nil {
+					sendMsg(c.Discord, i, fmt.Sprintf("No quotes found for %s", opts.User.Username))
+				} else {
+					sendMsg(c.Discord, i, "There are no quotes in the collection yet")
+				}
+				return
+			}
 
-		// if the user is specified, get a random quote for that user
-		if len(o[0].Options) != 0 {
-			quotee := o[0].Options[0].UserValue(c.Session)
+			chart, err := renderActivityChart(title, fillActivity(counts, opts.Interval, time.Now()), opts.Interval)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := generateEmbed(title, nil)
+			e.Image = &discordgo.MessageEmbedImage{URL: "attachment://" + statsChartName}
+			sendData(c.Discord, i, &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{e},
+				Files:  []*discordgo.File{{Name: statsChartName, ContentType: "image/png", Reader: bytes.NewReader(chart)}},
+			})
+		},
+	},
+	typedSubcommand[idOptions]{
+		Name:        "get",
+		Description: "Get a quote by its number",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "id",
+				Description: "Number of the quote, shown as #123 on every quote",
+				Required:    true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts idOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
 
-			quote, err = c.DB.getRandUserQuote(ctx, quotee.ID)
-			if err == sql.ErrNoRows {
-				sendMsg(c.Session, i, fmt.Sprintf("No quotes found for %s", quotee.Username))
+			quote, err := c.DB.getQuote(ctx, i.GuildID, opts.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				sendMsg(c.Discord, i, fmt.Sprintf("Quote #%d does not exist", opts.ID))
 				return
 			}
 			if err != nil {
-				sendErr(c.Session, i, err)
-				log.Printf("Error getting random user quote: %v", err)
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := quoteEmbed("Quote", quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[idOptions]{
+		Name:        "card",
+		Description: "Get a quote as an image to share",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "id",
+				Description: "Number of the quote, shown as #123 on every quote",
+				Required:    true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts idOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			quote, err := c.DB.getQuote(ctx, i.GuildID, opts.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				sendMsg(c.Discord, i, fmt.Sprintf("Quote #%d does not exist", opts.ID))
 				return
 			}
-		} else {
-			quote, err = c.DB.getRandQuote(ctx)
 			if err != nil {
-				sendErr(c.Session, i, err)
-				log.Printf("Error getting random quote: %v", err)
+				sendErr(c.Discord, i, err)
 				return
 			}
+
+			quotee := cardUser{Name: "Unknown user"}
+			if c.LookupUser != nil {
+				id := strings.TrimSuffix(strings.TrimPrefix(quote.Quotee, "<@"), ">")
+				u, err := c.LookupUser(ctx, id)
+				if err != nil {
+					// a card without the avatar beats no card
+					slog.WarnContext(withInteraction(ctx, i), "error looking up the quotee", "err", err)
+				}
+				if u.Name != "" {
+					quotee = u
+				}
+			}
+
+			card, err := renderCard(newQuoteCard(quote, quotee))
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			sendData(c.Discord, i, &discordgo.InteractionResponseData{
+				Files: []*discordgo.File{{Name: cardName(quote.ID), ContentType: "image/png", Reader: bytes.NewReader(card)}},
+			})
+		},
+	},
+	typedSubcommand[noOptions]{
+		Name:        "daily",
+		Description: "Get today's quote of the day",
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, _ noOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			loc, err := dailyLocation()
+			if err != nil {
+				slog.WarnContext(ctx, "using the local time zone for the quote of the day", "err", err)
+			}
+
+			quote, err := c.DB.getDailyQuote(ctx, i.GuildID, time.Now().In(loc))
+			if errors.Is(err, sql.ErrNoRows) {
+				sendMsg(c.Discord, i, "There are no quotes in the collection yet")
+				return
+			}
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			e := quoteEmbed(dailyTitle, quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[editOptions]{
+		Name:        "edit",
+		Description: "Fix the text or tags of a quote you added or that quotes you",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "id",
+				Description: "Number of the quote to edit",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "quote",
+				Description: "Corrected quote text",
+				Required:    false,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "tags",
+				Description:  "Comma-separated tags to replace the quote's tags with, or none to remove them",
+				Required:     false,
+				Autocomplete: true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts editOptions) {
+			if opts.Quote == "" && opts.Tags == "" {
+				sendEphemeral(c.Discord, i, "Give the corrected quote, its new tags or both")
+				return
+			}
+			var tags []string
+			if !strings.EqualFold(strings.TrimSpace(opts.Tags), noTags) {
+				var err error
+				if tags, err = parseTags(opts.Tags); err != nil {
+					sendEphemeral(c.Discord, i, err.Error())
+					return
+				}
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			quote, ok := ownedQuote(ctx, c, i, opts.ID)
+			if !ok {
+				return
+			}
+
+			edit := quoteEdit{Quote: opts.Quote, Tags: tags, SetTags: opts.Tags != ""}
+			if err := c.DB.editQuote(ctx, i.GuildID, opts.ID, edit); err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			if edit.Quote != "" {
+				quote.Quote = edit.Quote
+			}
+			if edit.SetTags {
+				quote.Tags = edit.Tags
+			}
+
+			e := quoteEmbed("Edited Quote", quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[idOptions]{
+		Name:        "delete",
+		Description: "Remove a quote you added or that quotes you",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "id",
+				Description: "Number of the quote to delete",
+				Required:    true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts idOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			quote, ok := ownedQuote(ctx, c, i, opts.ID)
+			if !ok {
+				return
+			}
+
+			err := c.DB.deleteQuote(ctx, i.GuildID, opts.ID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			e := quoteEmbed("Deleted Quote", quote)
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+	typedSubcommand[exportOptions]{
+		Name:        "export",
+		Description: "Download the collection as a file (bot owner only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "format",
+				Description: "File format (defaults to JSON)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "JSON", Value: string(formatJSON)},
+					{Name: "CSV", Value: string(formatCSV)},
+					{Name: "SQL", Value: string(formatSQL)},
+				},
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts exportOptions) {
+			// listing and encoding every quote can take longer than Discord waits for a first response
+			if err := deferReply(c.Discord, i, true); err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			format := opts.Format
+			if format == "" {
+				format = formatJSON
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			quotes, err := c.DB.listQuotes(ctx, i.GuildID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			var buf bytes.Buffer
+			table, d := storeTarget()
+			if err := writeExport(&buf, format, quotes, table, d); err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			sendFile(c.Discord, i, fmt.Sprintf("Exported %d quotes", len(quotes)), &discordgo.File{
+				Name:        fmt.Sprintf("quotes-%s.%s", i.GuildID, format),
+				ContentType: format.contentType(),
+				Reader:      &buf,
+			})
+		},
+	},
+	typedSubcommand[importOptions]{
+		Name:        "import",
+		Description: "Add quotes from a JSON or CSV file, skipping duplicates (bot owner only)",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionAttachment,
+				Name:        "file",
+				Description: "A .json or .csv file with quote, quotee, quoter and createdAt columns",
+				Required:    true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts importOptions) {
+			format, err := importFormatFromName(opts.File.Filename)
+			if err != nil {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
+
+			// downloading the file and inserting every row can take far longer than Discord waits for a first response
+			if err := deferReply(c.Discord, i, true); err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(withInteraction(context.Background(), i), importTimeout)
+			defer cancel()
+
+			rows, err := downloadImport(ctx, opts.File.URL, format)
+			if errors.Is(err, errImportTooLarge) {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			summary, err := importQuotes(ctx, c.DB, rows, i.GuildID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			slog.InfoContext(ctx, "imported quotes", "file", opts.File.Filename,
+				"inserted", summary.Inserted, "skipped", summary.Skipped, "rejected", len(summary.Rejected))
+			sendEphemeral(c.Discord, i, summary.String())
+		},
+	},
+	typedSubcommand[searchOptions]{
+		Name:        "search",
+		Description: "Search the collection of quotes for a specific string",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "query",
+				Description: `Words, "exact phrases", prefix* and AND/OR/NOT to search for`,
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "sort",
+				Description: "How to order the results (defaults to relevance)",
+				Required:    false,
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Relevance", Value: string(searchByRelevance)},
+					{Name: "Newest first", Value: string(searchByDate)},
+				},
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "tag",
+				Description:  "Only search quotes with this tag",
+				Required:     false,
+				Autocomplete: true,
+			},
+		},
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, opts searchOptions) {
+			tag, err := filterTag(opts.Tag)
+			if err != nil {
+				sendEphemeral(c.Discord, i, err.Error())
+				return
+			}
+
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			order := opts.Sort
+			if order == "" {
+				order = searchByRelevance
+			}
+
+			quotes, err := c.DB.searchQuote(ctx, i.GuildID, opts.Query, order, tag)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+
+			if len(quotes) == 0 {
+				sendMsg(c.Discord, i, fmt.Sprintf("No quotes found matching %q%s", opts.Query, taggedWith(tag)))
+				return
+			}
+
+			// keep every result so the paging buttons never have to query again
+			results := &searchResults{Term: opts.Query, Quotes: quotes, Total: len(quotes)}
+			if len(quotes) == searchLimit {
+				// only the first searchLimit matches are held, so count the rest to say how many were left out
+				if results.Total, err = c.DB.searchCount(ctx, i.GuildID, opts.Query, tag); err != nil {
+					sendErr(c.Discord, i, err)
+					return
+				}
+			}
+			c.Searches.put(i.ID, results)
+			sendData(c.Discord, i, searchPage(i.ID, results, 0))
+		},
+	},
+	typedSubcommand[noOptions]{
+		Name:        "tags",
+		Description: "List the tags quotes are filed under",
+		Handler: func(c *HandlerContext, i *discordgo.InteractionCreate, _ noOptions) {
+			ctx, cancel := interactionCtx(i)
+			defer cancel()
+
+			tags, err := c.DB.listTags(ctx, i.GuildID)
+			if err != nil {
+				sendErr(c.Discord, i, err)
+				return
+			}
+			if len(tags) == 0 {
+				sendMsg(c.Discord, i, "No quotes have been tagged yet")
+				return
+			}
+
+			e := generateEmbed("Quote Tags", nil)
+			e.Description = formatTags(tags[:min(len(tags), tagListLimit)])
+			if len(tags) > tagListLimit {
+				e.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("The %d most used of %d tags", tagListLimit, len(tags))}
+			}
+			sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+		},
+	},
+}
+
+// quoteHandler dispatches /quote interactions by subcommand name
+var quoteHandler = subcommandsByName(quoteSubcommands)
+
+// ownedQuote fetches a quote the invoking user is about to modify. It replies and returns false if the quote does
+// not exist or the user is not allowed to change it.
+func ownedQuote(ctx context.Context, c *HandlerContext, i *discordgo.InteractionCreate, id int64) (Quote, bool) {
+	quote, err := c.DB.getQuote(ctx, i.GuildID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		sendEphemeral(c.Discord, i, fmt.Sprintf("Quote #%d does not exist", id))
+		return quote, false
+	}
+	if err != nil {
+		sendErr(c.Discord, i, err)
+		return quote, false
+	}
+
+	if !canModify(quote, interactionUser(i)) {
+		sendEphemeral(c.Discord, i, fmt.Sprintf("Only the quoter, the quotee or <@%s> can change quote #%d", os.Getenv("DISC_BOT_OWNER_ID"), id))
+		return quote, false
+	}
+	return quote, true
+}
+
+// handleInteraction dispatches an interaction to its command or component handler, wrapped in interactionMiddleware
+func handleInteraction(c *HandlerContext, i *discordgo.InteractionCreate) {
+	var h handlerFunc
+	var ok bool
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		h, ok = commandHandlers[i.ApplicationCommandData().Name]
+	case discordgo.InteractionMessageComponent:
+		prefix, _, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		h, ok = componentHandlers[prefix]
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		if h, ok = autocompleteHandlers[i.ApplicationCommandData().Name]; ok {
+			chain(h, autocompleteMiddleware...)(c, i)
 		}
-		e := generateEmbed("Random Quote", quoteFields(quote))
-		sendEmbed(c.Session, i, []*discordgo.MessageEmbed{e})
+		return
+	}
+	if !ok {
+		return
+	}
+	chain(h, interactionMiddleware...)(c, i)
+}
+
+// commandHandlers is the entrypoint for application commands and maps to commands and subcommands
+var commandHandlers = map[string]handlerFunc{
+	"quote": func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		o := i.ApplicationCommandData().Options
+		subCommand := o[0].Name
+
+		h, ok := quoteHandler[subCommand]
+		if !ok {
+			sendErr(c.Discord, i, fmt.Errorf("unknown sub-command: %s", subCommand))
+			return
+		}
+		h.run(c, i, o[0].Options)
 	},
-	"search": func(c *HandlerContext, i *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) {
-		ctx, cancel := ctxWithTimeout()
+	saveQuoteCommand: func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		data := i.ApplicationCommandData()
+		msg, ok := data.Resolved.Messages[data.TargetID]
+		if !ok {
+			sendErr(c.Discord, i, fmt.Errorf("target message %s was not resolved", data.TargetID))
+			return
+		}
+		if msg.Content == "" {
+			sendEphemeral(c.Discord, i, "That message has no text to quote")
+			return
+		}
+
+		quoteSave := Quote{
+			Quote:     msg.Content,
+			Quotee:    fmt.Sprintf("<@%v>", msg.Author.ID),
+			Quoter:    fmt.Sprintf("<@%v>", interactionUser(i)),
+			CreatedAt: msg.Timestamp,
+			GuildID:   i.GuildID,
+			ChannelID: i.ChannelID,
+			MessageID: msg.ID,
+		}
+
+		ctx, cancel := interactionCtx(i)
 		defer cancel()
 
-		searchTerm := options[0].Options[0].StringValue()
-		quotes, err := c.DB.searchQuote(ctx, searchTerm)
+		var err error
+		quoteSave.ID, err = c.DB.createQuote(ctx, quoteSave)
 		if err != nil {
-			sendErr(c.Session, i, err)
-			log.Printf("Error searching quotes: %v", err)
+			sendErr(c.Discord, i, err)
 			return
 		}
+		e := quoteEmbed("Added Quote", quoteSave)
+		sendEmbed(c.Discord, i, []*discordgo.MessageEmbed{e})
+	},
+}
 
-		if len(quotes) == 0 {
-			sendMsg(c.Session, i, fmt.Sprintf("No quotes found matching %q", searchTerm))
+// componentHandlers is the entrypoint for message components such as buttons and maps the prefix of their custom ID
+var componentHandlers = map[string]handlerFunc{
+	searchComponentID: func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		key, page, err := parseSearchButtonID(i.MessageComponentData().CustomID)
+		if err != nil {
+			sendErr(c.Discord, i, err)
 			return
 		}
 
-		var e []*discordgo.MessageEmbed
-		for x, quote := range quotes {
-			emb := generateEmbed(fmt.Sprintf("Search Result %d", x+1), quoteFields(quote))
-			e = append(e, emb)
+		results, ok := c.Searches.get(key)
+		if !ok {
+			sendEphemeral(c.Discord, i, "This search has expired, please run /quote search again")
+			return
 		}
-		sendEmbed(c.Session, i, e)
+		updateMsg(c.Discord, i, searchPage(key, results, page))
 	},
 }
 
-// commandHandlers is the entrypoint for application commands and maps to commands and subcommands
-var commandHandlers = map[string]func(c *HandlerContext, i *discordgo.InteractionCreate){
+// autocompleteHandlers suggest values for the options of a command as the user types them, keyed by command name
+var autocompleteHandlers = map[string]handlerFunc{
 	"quote": func(c *HandlerContext, i *discordgo.InteractionCreate) {
 		o := i.ApplicationCommandData().Options
-		subCommand := o[0].Name
-
-		h, ok := quoteHandler[subCommand]
-		if !ok {
-			sendErr(c.Session, i, fmt.Errorf("unknown sub-command: %s", subCommand))
+		if len(o) == 0 || i.GuildID == "" {
+			sendChoices(c.Discord, i, nil)
 			return
 		}
-		h(c, i, o)
+
+		// every option that autocompletes takes tags, and the tags option of add and edit takes a list of them
+		for _, opt := range o[0].Options {
+			if opt.Focused {
+				ctx, cancel := interactionCtx(i)
+				defer cancel()
+
+				sendChoices(c.Discord, i, tagChoices(ctx, c, i.GuildID, opt.StringValue(), opt.Name == "tags"))
+				return
+			}
+		}
+		sendChoices(c.Discord, i, nil)
 	},
 }
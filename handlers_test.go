@@ -0,0 +1,709 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	testOwner  = "111111111111111111"
+	testUser   = "222222222222222222"
+	testOther  = "333333333333333333"
+	testLurker = "444444444444444444"
+)
+
+// lastInteractionID makes every test interaction ID a unique, valid snowflake
+var lastInteractionID atomic.Int64
+
+func init() {
+	lastInteractionID.Store(1200000000000000000)
+}
+
+// newTestHandlerContext creates handler dependencies backed by a fake Discord and a memStore seeded with three
+// quotes: #1 and #3 quote testUser, #2 quotes testOther
+func newTestHandlerContext(t *testing.T) (*HandlerContext, *fakeResponder) {
+	t.Helper()
+	t.Setenv("DISC_BOT_OWNER_ID", testOwner)
+
+	db := newMemStore()
+	insertQuote(t, db, Quote{Quote: "the cake is a lie", Quotee: "<@" + testUser + ">", Quoter: "<@" + testOther + ">", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, db, Quote{Quote: "never gonna give you up", Quotee: "<@" + testOther + ">", Quoter: "<@" + testUser + ">", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, db, Quote{Quote: "more cake please", Quotee: "<@" + testUser + ">", Quoter: "<@" + testUser + ">", CreatedAt: time.Now(), GuildID: testGuild})
+
+	f := &fakeResponder{}
+	return &HandlerContext{Discord: f, DB: db, Searches: newSearchCache()}, f
+}
+
+// option builds a subcommand option. User options hold the user ID, as Discord sends them.
+func option(name string, typ discordgo.ApplicationCommandOptionType, value any) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{Name: name, Type: typ, Value: value}
+}
+
+// quoteInteraction builds a /quote subcommand sent by user in testGuild, resolving every user option
+func quoteInteraction(user string, sub string, opts ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	resolved := &discordgo.ApplicationCommandInteractionDataResolved{Users: map[string]*discordgo.User{}}
+	for _, o := range opts {
+		if o.Type == discordgo.ApplicationCommandOptionUser {
+			id := o.Value.(string)
+			resolved.Users[id] = &discordgo.User{ID: id, Username: "name-" + id[:3]}
+		}
+	}
+
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:      fmt.Sprint(lastInteractionID.Add(1)),
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: testGuild,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: user}},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name: "quote",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: sub, Type: discordgo.ApplicationCommandOptionSubCommand, Options: opts},
+			},
+			Resolved: resolved,
+		},
+	}}
+}
+
+func TestQuoteHandlers(t *testing.T) {
+	id := func(n int64) *discordgo.ApplicationCommandInteractionDataOption {
+		// Discord sends every number as a JSON number
+		return option("id", discordgo.ApplicationCommandOptionInteger, float64(n))
+	}
+	user := func(name, id string) *discordgo.ApplicationCommandInteractionDataOption {
+		return option(name, discordgo.ApplicationCommandOptionUser, id)
+	}
+	text := func(name, s string) *discordgo.ApplicationCommandInteractionDataOption {
+		return option(name, discordgo.ApplicationCommandOptionString, s)
+	}
+
+	tests := []struct {
+		name      string
+		i         *discordgo.InteractionCreate
+		content   string
+		titles    []string
+		ephemeral bool
+		after     func(t *testing.T, db QuoteStore)
+	}{
+		{name: "count", i: quoteInteraction(testUser, "count"), content: "There are 3 quotes in the collection"},
+		{
+			name:   "add",
+			i:      quoteInteraction(testUser, "add", text("quote", "brand new"), user("quotee", testOther)),
+			titles: []string{"Added Quote #4"},
+			after: func(t *testing.T, db QuoteStore) {
+				q, err := db.getQuote(context.Background(), testGuild, 4)
+				if err != nil {
+					t.Fatalf("getQuote: %v", err)
+				}
+				if q.Quote != "brand new" || q.Quotee != "<@"+testOther+">" || q.Quoter != "<@"+testUser+">" {
+					t.Errorf("added %+v", q)
+				}
+			},
+		},
+		{name: "leaderboard", i: quoteInteraction(testUser, "leaderboard"), titles: []string{"Quote Leaderboard"}},
+		{name: "latest", i: quoteInteraction(testUser, "latest"), titles: []string{"Latest Quote #3"}},
+		{name: "latest for user", i: quoteInteraction(testUser, "latest", user("user", testOther)), titles: []string{"Latest Quote #2"}},
+		{name: "latest for user without quotes", i: quoteInteraction(testUser, "latest", user("user", testLurker)), content: "No quotes found for name-444"},
+		{name: "random", i: quoteInteraction(testUser, "random"), titles: []string{"Random Quote #"}},
+		{name: "random for user", i: quoteInteraction(testUser, "random", user("user", testOther)), titles: []string{"Random Quote #2"}},
+		{name: "random for user without quotes", i: quoteInteraction(testUser, "random", user("user", testLurker)), content: "No quotes found for name-444"},
+		{name: "get", i: quoteInteraction(testUser, "get", id(2)), titles: []string{"Quote #2"}},
+		{name: "get missing", i: quoteInteraction(testUser, "get", id(99)), content: "Quote #99 does not exist"},
+		{name: "daily", i: quoteInteraction(testUser, "daily"), titles: []string{"Quote of the Day #"}},
+		{
+			name:   "edit as quoter",
+			i:      quoteInteraction(testOther, "edit", id(1), text("quote", "the cake was real")),
+			titles: []string{"Edited Quote #1"},
+			after: func(t *testing.T, db QuoteStore) {
+				if q, _ := db.getQuote(context.Background(), testGuild, 1); q.Quote != "the cake was real" {
+					t.Errorf("quote #1 = %q after edit", q.Quote)
+				}
+			},
+		},
+		{
+			name:      "edit by someone else",
+			i:         quoteInteraction(testOther, "edit", id(3), text("quote", "vandalism")),
+			content:   "Only the quoter, the quotee or <@" + testOwner + "> can change quote #3",
+			ephemeral: true,
+			after: func(t *testing.T, db QuoteStore) {
+				if q, _ := db.getQuote(context.Background(), testGuild, 3); q.Quote != "more cake please" {
+					t.Errorf("quote #3 = %q after a refused edit", q.Quote)
+				}
+			},
+		},
+		{name: "edit missing", i: quoteInteraction(testOwner, "edit", id(99), text("quote", "x")), content: "Quote #99 does not exist", ephemeral: true},
+		{
+			name:   "delete as owner",
+			i:      quoteInteraction(testOwner, "delete", id(3)),
+			titles: []string{"Deleted Quote #3"},
+			after: func(t *testing.T, db QuoteStore) {
+				if n, _ := db.quoteCount(context.Background(), testGuild); n != 2 {
+					t.Errorf("%d quotes left after delete, want 2", n)
+				}
+			},
+		},
+		{name: "delete by someone else", i: quoteInteraction(testLurker, "delete", id(1)), content: "can change quote #1", ephemeral: true},
+		{name: "search", i: quoteInteraction(testUser, "search", text("query", "cake")), titles: []string{"Search Result 1 #", "Search Result 2 #"}},
+		{name: "search without results", i: quoteInteraction(testUser, "search", text("query", "zebra")), content: `No quotes found matching "zebra"`},
+		{name: "export by someone else", i: quoteInteraction(testUser, "export"), content: "Only <@" + testOwner + "> can export the collection", ephemeral: true},
+		{name: "unknown subcommand", i: quoteInteraction(testUser, "juggle"), content: "unknown sub-command: juggle", ephemeral: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTestHandlerContext(t)
+			handleInteraction(c, tt.i)
+
+			r := f.reply(t)
+			if !strings.Contains(r.Content, tt.content) {
+				t.Errorf("content = %q, want it to contain %q", r.Content, tt.content)
+			}
+			if got := r.Flags&discordgo.MessageFlagsEphemeral != 0; got != tt.ephemeral {
+				t.Errorf("ephemeral = %v, want %v", got, tt.ephemeral)
+			}
+			if len(r.Embeds) != len(tt.titles) {
+				t.Fatalf("got %d embeds, want %d", len(r.Embeds), len(tt.titles))
+			}
+			for x, title := range tt.titles {
+				if !strings.HasPrefix(r.Embeds[x].Title, title) {
+					t.Errorf("embed %d title = %q, want prefix %q", x, r.Embeds[x].Title, title)
+				}
+			}
+			if tt.after != nil {
+				tt.after(t, c.DB)
+			}
+		})
+	}
+}
+
+func TestQuoteHandlerOutsideGuild(t *testing.T) {
+	c, f := newTestHandlerContext(t)
+	i := quoteInteraction(testUser, "count")
+	i.GuildID = ""
+	i.User, i.Member = i.Member.User, nil
+
+	handleInteraction(c, i)
+	if r := f.reply(t); r.Content != "Quotes are only available inside a server" {
+		t.Errorf("content = %q", r.Content)
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	c, f := newTestHandlerContext(t)
+	handleInteraction(c, quoteInteraction(testOwner, "export", option("format", discordgo.ApplicationCommandOptionString, "csv")))
+
+	// exports are deferred as ephemeral, then the deferred response is edited with the file
+	if got := f.methods(); len(got) != 2 || got[0] != respondDeferred || got[1] != "edit" {
+		t.Fatalf("calls = %q, want a deferral then an edit", got)
+	}
+	r := f.reply(t)
+	if r.Content != "Exported 3 quotes" {
+		t.Errorf("content = %q", r.Content)
+	}
+	if len(r.Files) != 1 || r.Files[0].Name != "quotes-"+testGuild+".csv" || r.Files[0].ContentType != "text/csv" {
+		t.Fatalf("files = %+v, want one CSV", r.Files)
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "quote,quotee,quoter,createdAt\nimported,%s,%s,2024-01-02\nthe cake is a lie,%s,%s,nope\n", testUser, testOther, testUser, testOther)
+	}))
+	defer srv.Close()
+
+	c, f := newTestHandlerContext(t)
+	i := quoteInteraction(testOwner, "import", option("file", discordgo.ApplicationCommandOptionAttachment, "9"))
+	data := i.ApplicationCommandData()
+	data.Resolved.Attachments = map[string]*discordgo.MessageAttachment{"9": {ID: "9", Filename: "quotes.csv", URL: srv.URL}}
+	i.Data = data
+
+	handleInteraction(c, i)
+	r := f.reply(t)
+	if !strings.HasPrefix(r.Content, "Inserted 1, skipped 0 duplicates, rejected 1") {
+		t.Errorf("content = %q", r.Content)
+	}
+	if n, _ := c.DB.quoteCount(context.Background(), testGuild); n != 4 {
+		t.Errorf("%d quotes after import, want 4", n)
+	}
+}
+
+func TestSaveQuoteCommand(t *testing.T) {
+	c, f := newTestHandlerContext(t)
+	sent := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:        fmt.Sprint(lastInteractionID.Add(1)),
+		Type:      discordgo.InteractionApplicationCommand,
+		GuildID:   testGuild,
+		ChannelID: "555",
+		Member:    &discordgo.Member{User: &discordgo.User{ID: testUser}},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:     saveQuoteCommand,
+			TargetID: "666",
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{Messages: map[string]*discordgo.Message{
+				"666": {ID: "666", Content: "said in chat", Author: &discordgo.User{ID: testOther}, Timestamp: sent},
+			}},
+		},
+	}}
+
+	handleInteraction(c, i)
+	if r := f.reply(t); len(r.Embeds) != 1 || r.Embeds[0].Title != "Added Quote #4" {
+		t.Fatalf("reply = %+v", r)
+	}
+	q, err := c.DB.getQuote(context.Background(), testGuild, 4)
+	if err != nil {
+		t.Fatalf("getQuote: %v", err)
+	}
+	if q.Quotee != "<@"+testOther+">" || !q.CreatedAt.Equal(sent) || q.JumpLink() != "https://discord.com/channels/100/555/666" {
+		t.Errorf("saved %+v", q)
+	}
+}
+
+func TestHandlersWithoutMember(t *testing.T) {
+	// only the user is set, as in a DM, and the handlers are run without the middleware that turns DMs away
+	asUser := func(i *discordgo.InteractionCreate) *discordgo.InteractionCreate {
+		i.User, i.Member = i.Member.User, nil
+		return i
+	}
+	save := asUser(&discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:      fmt.Sprint(lastInteractionID.Add(1)),
+		Type:    discordgo.InteractionApplicationCommand,
+		GuildID: testGuild,
+		Member:  &discordgo.Member{User: &discordgo.User{ID: testUser}},
+		Data: discordgo.ApplicationCommandInteractionData{
+			Name:     saveQuoteCommand,
+			TargetID: "666",
+			Resolved: &discordgo.ApplicationCommandInteractionDataResolved{Messages: map[string]*discordgo.Message{
+				"666": {ID: "666", Content: "said in chat", Author: &discordgo.User{ID: testOther}, Timestamp: time.Now()},
+			}},
+		},
+	}})
+
+	tests := []struct {
+		name  string
+		i     *discordgo.InteractionCreate
+		title string
+	}{
+		{"add", asUser(quoteInteraction(testUser, "add", option("quote", discordgo.ApplicationCommandOptionString, "brand new"), option("quotee", discordgo.ApplicationCommandOptionUser, testOther))), "Added Quote #4"},
+		{"profile of the caller", asUser(quoteInteraction(testUser, "profile")), "Quote Profile"},
+		{"delete an owned quote", asUser(quoteInteraction(testUser, "delete", option("id", discordgo.ApplicationCommandOptionInteger, float64(3)))), ""},
+		{"save a message", save, "Added Quote #4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTestHandlerContext(t)
+			commandHandlers[tt.i.ApplicationCommandData().Name](c, tt.i)
+
+			r := f.reply(t)
+			if tt.title == "" {
+				if r.Flags&discordgo.MessageFlagsEphemeral != 0 {
+					t.Errorf("reply = %+v, want the change made", r)
+				}
+				return
+			}
+			if len(r.Embeds) != 1 || r.Embeds[0].Title != tt.title {
+				t.Errorf("reply = %+v, want an embed titled %q", r, tt.title)
+			}
+		})
+	}
+}
+
+func TestSearchPagingComponent(t *testing.T) {
+	c, f := newTestHandlerContext(t)
+	for x := 0; x < searchPageSize; x++ {
+		insertQuote(t, c.DB, Quote{Quote: fmt.Sprintf("cake %d", x), Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+	}
+
+	search := quoteInteraction(testUser, "search", option("query", discordgo.ApplicationCommandOptionString, "cake"))
+	handleInteraction(c, search)
+
+	press := func(customID string) *discordgo.InteractionResponseData {
+		handleInteraction(c, &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+			ID:      fmt.Sprint(lastInteractionID.Add(1)),
+			Type:    discordgo.InteractionMessageComponent,
+			GuildID: testGuild,
+			Member:  &discordgo.Member{User: &discordgo.User{ID: testUser}},
+			Data:    discordgo.MessageComponentInteractionData{CustomID: customID},
+		}})
+		return f.reply(t)
+	}
+
+	r := press(searchButtonID(search.ID, 1))
+	if len(r.Embeds) != 2 || !strings.HasPrefix(r.Embeds[0].Title, "Search Result 6 #") {
+		t.Errorf("page 2 = %d embeds starting %q", len(r.Embeds), r.Embeds[0].Title)
+	}
+
+	r = press(searchButtonID("expired", 1))
+	if r.Content != "This search has expired, please run /quote search again" || r.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("expired search reply = %+v", r)
+	}
+}
+
+func TestLeaderboardHandler(t *testing.T) {
+	text := func(name, s string) *discordgo.ApplicationCommandInteractionDataOption {
+		return option(name, discordgo.ApplicationCommandOptionString, s)
+	}
+	tests := []struct {
+		name    string
+		i       *discordgo.InteractionCreate
+		title   string
+		fields  [2]string // names of the ranking and own rank fields
+		values  [2]string
+		refusal string
+	}{
+		{
+			name:   "quotees",
+			i:      quoteInteraction(testUser, "leaderboard"),
+			title:  "Quote Leaderboard",
+			fields: [2]string{"All-time", "Your Rank"},
+			values: [2]string{"`1:` <@" + testUser + ">: 2\n`2:` <@" + testOther + ">: 1", "`1:` <@" + testUser + ">: 2"},
+		},
+		{
+			name:   "quoters this week",
+			i:      quoteInteraction(testOther, "leaderboard", text("mode", "quoter"), text("period", "week")),
+			title:  "Quoter Leaderboard",
+			fields: [2]string{"Past week", "Your Rank"},
+			values: [2]string{"`1:` <@" + testUser + ">: 2\n`2:` <@" + testOther + ">: 1", "`2:` <@" + testOther + ">: 1"},
+		},
+		{
+			name:   "caller without quotes",
+			i:      quoteInteraction(testLurker, "leaderboard", text("to", "2000-01-01")),
+			title:  "Quote Leaderboard",
+			fields: [2]string{"Until Jan 1, 2000", "Your Rank"},
+			values: [2]string{"No quotes in this period", "You have no quotes in this period"},
+		},
+		{
+			name:    "bad range",
+			i:       quoteInteraction(testUser, "leaderboard", text("from", "2024-02-01"), text("to", "2024-01-01")),
+			refusal: "the date range must start on or before the day it ends",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTestHandlerContext(t)
+			handleInteraction(c, tt.i)
+
+			r := f.reply(t)
+			if tt.refusal != "" {
+				if r.Content != tt.refusal || r.Flags&discordgo.MessageFlagsEphemeral == 0 {
+					t.Errorf("reply = %+v, want a private refusal", r)
+				}
+				return
+			}
+			if len(r.Embeds) != 1 || r.Embeds[0].Title != tt.title || len(r.Embeds[0].Fields) != 2 {
+				t.Fatalf("reply = %+v, want one %q embed with 2 fields", r, tt.title)
+			}
+			for x, field := range r.Embeds[0].Fields {
+				if field.Name != tt.fields[x] || field.Value != tt.values[x] {
+					t.Errorf("field %d = %q: %q, want %q: %q", x, field.Name, field.Value, tt.fields[x], tt.values[x])
+				}
+			}
+		})
+	}
+}
+
+func TestProfileHandler(t *testing.T) {
+	today := time.Now().Format("Jan 2, 2006")
+	tests := []struct {
+		name   string
+		i      *discordgo.InteractionCreate
+		user   string
+		fields []string // name: value
+	}{
+		{
+			name: "own profile",
+			i:    quoteInteraction(testUser, "profile"),
+			user: testUser,
+			fields: []string{
+				"Quoted: 2 (rank #1)",
+				"Quotes Added: 2 (rank #1)",
+				"First Quote: #1 on " + today + ": the cake is a lie",
+				"Latest Quote: #3 on " + today + ": more cake please",
+				"Busiest Month: " + time.Now().UTC().Format("January 2006") + " with 2 quotes",
+				"Quoted Most By: <@" + testOther + "> with 1 quote",
+			},
+		},
+		{
+			name: "another user",
+			i:    quoteInteraction(testUser, "profile", option("user", discordgo.ApplicationCommandOptionUser, testOther)),
+			user: testOther,
+			fields: []string{
+				"Quoted: 1 (rank #2)",
+				"Quotes Added: 1 (rank #2)",
+				"First Quote: #2 on " + today + ": never gonna give you up",
+				"Latest Quote: #2 on " + today + ": never gonna give you up",
+				"Busiest Month: " + time.Now().UTC().Format("January 2006") + " with 1 quote",
+				"Quoted Most By: <@" + testUser + "> with 1 quote",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTestHandlerContext(t)
+			handleInteraction(c, tt.i)
+
+			r := f.reply(t)
+			if len(r.Embeds) != 1 || r.Embeds[0].Title != "Quote Profile" || r.Embeds[0].Description != "<@"+tt.user+">" {
+				t.Fatalf("reply = %+v, want the profile of %s", r, tt.user)
+			}
+			var fields []string
+			for _, field := range r.Embeds[0].Fields {
+				fields = append(fields, field.Name+": "+field.Value)
+			}
+			if got, want := strings.Join(fields, "\n"), strings.Join(tt.fields, "\n"); got != want {
+				t.Errorf("fields =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+
+	t.Run("user without quotes", func(t *testing.T) {
+		c, f := newTestHandlerContext(t)
+		handleInteraction(c, quoteInteraction(testUser, "profile", option("user", discordgo.ApplicationCommandOptionUser, testLurker)))
+		if r := f.reply(t); r.Content != "No quotes found for name-444" {
+			t.Errorf("reply = %+v", r)
+		}
+	})
+}
+
+func TestStatsHandler(t *testing.T) {
+	c, f := newTestHandlerContext(t)
+	handleInteraction(c, quoteInteraction(testUser, "stats",
+		option("user", discordgo.ApplicationCommandOptionUser, testOther),
+		option("interval", discordgo.ApplicationCommandOptionString, "week")))
+
+	r := f.reply(t)
+	if len(r.Embeds) != 1 || r.Embeds[0].Title != "Quotes of name-333 per week" ||
+		r.Embeds[0].Image == nil || r.Embeds[0].Image.URL != "attachment://"+statsChartName {
+		t.Fatalf("reply = %+v, want an embed showing the chart", r)
+	}
+	if len(r.Files) != 1 || r.Files[0].Name != statsChartName || r.Files[0].ContentType != "image/png" {
+		t.Fatalf("files = %+v, want the chart", r.Files)
+	}
+	if _, err := png.Decode(r.Files[0].Reader); err != nil {
+		t.Errorf("chart is not a PNG: %v", err)
+	}
+
+	c, f = newTestHandlerContext(t)
+	handleInteraction(c, quoteInteraction(testUser, "stats", option("user", discordgo.ApplicationCommandOptionUser, testLurker)))
+	if r := f.reply(t); r.Content != "No quotes found for name-444" {
+		t.Errorf("reply = %+v", r)
+	}
+}
+
+func TestCardHandler(t *testing.T) {
+	id := func(n int) *discordgo.ApplicationCommandInteractionDataOption {
+		return option("id", discordgo.ApplicationCommandOptionInteger, float64(n))
+	}
+
+	c, f := newTestHandlerContext(t)
+	var looked []string
+	c.LookupUser = func(ctx context.Context, id string) (cardUser, error) {
+		looked = append(looked, id)
+		return cardUser{Name: "someone"}, nil
+	}
+	handleInteraction(c, quoteInteraction(testOther, "card", id(2)))
+
+	r := f.reply(t)
+	if len(r.Files) != 1 || r.Files[0].Name != "quote-2.png" || r.Files[0].ContentType != "image/png" {
+		t.Fatalf("files = %+v, want the card", r.Files)
+	}
+	if len(looked) != 1 || looked[0] != testOther {
+		t.Errorf("looked up %q, want the quotee %s", looked, testOther)
+	}
+
+	// the card is still sent when the quotee cannot be looked up
+	c, f = newTestHandlerContext(t)
+	c.LookupUser = func(ctx context.Context, id string) (cardUser, error) {
+		return cardUser{}, errors.New("unknown user")
+	}
+	handleInteraction(c, quoteInteraction(testUser, "card", id(1)))
+	if r := f.reply(t); len(r.Files) != 1 {
+		t.Errorf("reply = %+v, want a card", r)
+	}
+
+	c, f = newTestHandlerContext(t)
+	handleInteraction(c, quoteInteraction(testUser, "card", id(99)))
+	if r := f.reply(t); r.Content != "Quote #99 does not exist" {
+		t.Errorf("reply = %+v", r)
+	}
+}
+
+func TestTagHandlers(t *testing.T) {
+	text := func(name, s string) *discordgo.ApplicationCommandInteractionDataOption {
+		return option(name, discordgo.ApplicationCommandOptionString, s)
+	}
+	id := func(n int) *discordgo.ApplicationCommandInteractionDataOption {
+		return option("id", discordgo.ApplicationCommandOptionInteger, float64(n))
+	}
+	// newTaggedContext tags #1 funny and work, and #2 funny
+	newTaggedContext := func(t *testing.T) (*HandlerContext, *fakeResponder) {
+		c, f := newTestHandlerContext(t)
+		for id, tags := range map[int64][]string{1: {"funny", "work"}, 2: {"funny"}} {
+			if err := c.DB.editQuote(context.Background(), testGuild, id, quoteEdit{Tags: tags, SetTags: true}); err != nil {
+				t.Fatalf("editQuote: %v", err)
+			}
+		}
+		return c, f
+	}
+	tagsOf := func(t *testing.T, db QuoteStore, id int64) string {
+		q, err := db.getQuote(context.Background(), testGuild, id)
+		if err != nil {
+			t.Fatalf("getQuote: %v", err)
+		}
+		return strings.Join(q.Tags, ",")
+	}
+
+	tests := []struct {
+		name      string
+		i         *discordgo.InteractionCreate
+		content   string
+		titles    []string
+		ephemeral bool
+		after     func(t *testing.T, db QuoteStore)
+	}{
+		{
+			name: "add with tags",
+			i: quoteInteraction(testUser, "add", text("quote", "brand new"),
+				option("quotee", discordgo.ApplicationCommandOptionUser, testOther), text("tags", "Work, in jokes,work")),
+			titles: []string{"Added Quote #4"},
+			after: func(t *testing.T, db QuoteStore) {
+				if got := tagsOf(t, db, 4); got != "in-jokes,work" {
+					t.Errorf("tags of #4 = %q, want in-jokes,work", got)
+				}
+			},
+		},
+		{
+			name: "add with a bad tag",
+			i: quoteInteraction(testUser, "add", text("quote", "brand new"),
+				option("quotee", discordgo.ApplicationCommandOptionUser, testOther), text("tags", "wow!")),
+			content:   "tags may only contain letters, numbers and dashes",
+			ephemeral: true,
+		},
+		{
+			name:   "edit tags only",
+			i:      quoteInteraction(testOther, "edit", id(1), text("tags", "classic")),
+			titles: []string{"Edited Quote #1"},
+			after: func(t *testing.T, db QuoteStore) {
+				q, _ := db.getQuote(context.Background(), testGuild, 1)
+				if q.Quote != "the cake is a lie" || strings.Join(q.Tags, ",") != "classic" {
+					t.Errorf("quote #1 = %q tagged %q after editing its tags", q.Quote, q.Tags)
+				}
+			},
+		},
+		{
+			name:   "edit removing tags",
+			i:      quoteInteraction(testOther, "edit", id(1), text("tags", "None")),
+			titles: []string{"Edited Quote #1"},
+			after: func(t *testing.T, db QuoteStore) {
+				if got := tagsOf(t, db, 1); got != "" {
+					t.Errorf("tags of #1 = %q, want none", got)
+				}
+			},
+		},
+		{name: "edit without changes", i: quoteInteraction(testOther, "edit", id(1)), content: "Give the corrected quote, its new tags or both", ephemeral: true},
+		{name: "random with tag", i: quoteInteraction(testUser, "random", text("tag", "Work")), titles: []string{"Random Quote #1"}},
+		{name: "random with unused tag", i: quoteInteraction(testUser, "random", text("tag", "nope")), content: "No quotes found tagged `nope`"},
+		{
+			name:    "random for user with tag",
+			i:       quoteInteraction(testUser, "random", option("user", discordgo.ApplicationCommandOptionUser, testOther), text("tag", "work")),
+			content: "No quotes found for name-" + testOther[:3] + " tagged `work`",
+		},
+		{name: "search with tag", i: quoteInteraction(testUser, "search", text("query", "cake"), text("tag", "funny")), titles: []string{"Search Result 1 #1"}},
+		{name: "search with tag without results", i: quoteInteraction(testUser, "search", text("query", "please"), text("tag", "funny")), content: `No quotes found matching "please" tagged ` + "`funny`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, f := newTaggedContext(t)
+			handleInteraction(c, tt.i)
+
+			r := f.reply(t)
+			if !strings.Contains(r.Content, tt.content) {
+				t.Errorf("content = %q, want it to contain %q", r.Content, tt.content)
+			}
+			if got := r.Flags&discordgo.MessageFlagsEphemeral != 0; got != tt.ephemeral {
+				t.Errorf("ephemeral = %v, want %v", got, tt.ephemeral)
+			}
+			if len(r.Embeds) != len(tt.titles) {
+				t.Fatalf("got %d embeds, want %d", len(r.Embeds), len(tt.titles))
+			}
+			for x, title := range tt.titles {
+				if !strings.HasPrefix(r.Embeds[x].Title, title) {
+					t.Errorf("embed %d title = %q, want prefix %q", x, r.Embeds[x].Title, title)
+				}
+			}
+			if tt.after != nil {
+				tt.after(t, c.DB)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		c, f := newTaggedContext(t)
+		handleInteraction(c, quoteInteraction(testUser, "tags"))
+		r := f.reply(t)
+		if len(r.Embeds) != 1 || r.Embeds[0].Title != "Quote Tags" {
+			t.Fatalf("reply = %+v, want the tag list", r)
+		}
+		if want := "`funny`: 2 quotes\n`work`: 1 quote"; r.Embeds[0].Description != want {
+			t.Errorf("tag list = %q, want %q", r.Embeds[0].Description, want)
+		}
+	})
+
+	t.Run("list without tags", func(t *testing.T) {
+		c, f := newTestHandlerContext(t)
+		handleInteraction(c, quoteInteraction(testUser, "tags"))
+		if r := f.reply(t); r.Content != "No quotes have been tagged yet" {
+			t.Errorf("reply = %+v", r)
+		}
+	})
+}
+
+func TestTagAutocomplete(t *testing.T) {
+	tests := []struct {
+		sub, option, typed string
+		want               []string
+	}{
+		{"random", "tag", "", []string{"funny", "work"}},
+		{"random", "tag", "W", []string{"work"}},
+		{"search", "tag", "zebra", nil},
+		{"add", "tags", "work, f", []string{"work, funny"}},
+		// tags already in the list are not suggested again
+		{"edit", "tags", "funny,", []string{"funny, work"}},
+		{"edit", "tags", "funny, work, ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sub+" "+tt.typed, func(t *testing.T) {
+			c, f := newTestHandlerContext(t)
+			for id, tags := range map[int64][]string{1: {"funny", "work"}, 2: {"funny"}} {
+				if err := c.DB.editQuote(context.Background(), testGuild, id, quoteEdit{Tags: tags, SetTags: true}); err != nil {
+					t.Fatalf("editQuote: %v", err)
+				}
+			}
+			focused := option(tt.option, discordgo.ApplicationCommandOptionString, tt.typed)
+			focused.Focused = true
+			i := quoteInteraction(testUser, tt.sub, focused)
+			i.Type = discordgo.InteractionApplicationCommandAutocomplete
+
+			handleInteraction(c, i)
+			calls := f.methods()
+			if len(calls) != 1 || f.calls[0].Type != discordgo.InteractionApplicationCommandAutocompleteResult {
+				t.Fatalf("calls = %v, want one autocomplete result", calls)
+			}
+			var got []string
+			for _, choice := range f.calls[0].Data.Choices {
+				got = append(got, choice.Value.(string))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("choices = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,36 +3,86 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 const (
-	dbTimeout   = 10 * time.Second
-	embedColor  = 3093151 // dark blue
-	resultLimit = 10
+	dbTimeout = 10 * time.Second
+	// importTimeout allows for the one insert per row an import makes
+	importTimeout = 5 * time.Minute
+	embedColor    = 3093151 // dark blue
+	resultLimit   = 10
+	searchLimit   = 100 // most search results held for paging
 )
 
+// quoteTime formats when a quote was created, as every quote shows it
+func quoteTime(q Quote) string {
+	return q.CreatedAt.Local().Format(time.RFC822)
+}
+
 // quoteFields creates the embed fields for a quote
 func quoteFields(q Quote) []*discordgo.MessageEmbedField {
-	quoteTime := q.CreatedAt.Local().Format(time.RFC822)
-	return []*discordgo.MessageEmbedField{
+	fields := []*discordgo.MessageEmbedField{
 		{Name: "Quote", Value: q.Quote},
 		{Name: "Quotee", Value: q.Quotee},
 		{Name: "Quoter", Value: q.Quoter},
-		{Name: "Created At", Value: quoteTime},
+		{Name: "Created At", Value: quoteTime(q)},
+	}
+	if link := q.JumpLink(); link != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Source", Value: link})
+	}
+	if len(q.Tags) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Tags", Value: strings.Join(q.Tags, ", ")})
+	}
+	return fields
+}
+
+// isOwner reports whether a user is the bot owner
+func isOwner(userID string) bool {
+	return userID == os.Getenv("DISC_BOT_OWNER_ID")
+}
+
+// canModify reports whether a user may edit or delete a quote: only its quoter, its quotee or the bot owner may
+func canModify(q Quote, userID string) bool {
+	mention := fmt.Sprintf("<@%s>", userID)
+	return q.Quoter == mention || q.Quotee == mention || isOwner(userID)
+}
+
+// leaderboardEntry is a single row of a leaderboard: a quotee or quoter mention and their number of quotes
+type leaderboardEntry struct {
+	User  string `json:"user"`
+	Count int    `json:"count"`
+}
+
+// formatLeaderboard renders leaderboard entries as numbered lines, one per user
+func formatLeaderboard(entries []leaderboardEntry) string {
+	lines := make([]string, 0, len(entries))
+	for x, entry := range entries {
+		lines = append(lines, formatRank(x+1, entry))
 	}
+	return strings.Join(lines, "\n")
+}
+
+// formatRank renders one numbered leaderboard line
+func formatRank(rank int, entry leaderboardEntry) string {
+	return fmt.Sprintf("`%d:` %s: %d", rank, entry.User, entry.Count)
 }
 
 // sendErr sends an ephemeral message to the user who sent the command with the error message
-func sendErr(s *discordgo.Session, i *discordgo.InteractionCreate, err error) {
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+func sendErr(s Responder, i *discordgo.InteractionCreate, err error) {
+	commandErrors.WithLabelValues(commandName(i)).Inc()
+	slog.ErrorContext(withInteraction(context.Background(), i), "command failed", "err", err)
+
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("Error executing command, please attempt it again. If this persists please contact <@%s> with the the error message.\nError message: %s",
-				os.Getenv("DISC_BOT_OWNER_ID"), err),
+			Content: fmt.Sprintf("Error executing command, please attempt it again. If this persists please contact <@%s> with the the error message and reference.\nError message: %s\nReference: %s",
+				os.Getenv("DISC_BOT_OWNER_ID"), err, correlationID(i)),
 			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
@@ -47,10 +97,15 @@ func generateEmbed(t string, f []*discordgo.MessageEmbedField) *discordgo.Messag
 	}
 }
 
+// quoteEmbed creates an embed for a single quote, titled with the quote's number so it can be cited later
+func quoteEmbed(t string, q Quote) *discordgo.MessageEmbed {
+	return generateEmbed(fmt.Sprintf("%s #%d", t, q.ID), quoteFields(q))
+}
+
 // sendEmbed sends an embeded interaction response to the user who sent the command
-func sendEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, e []*discordgo.MessageEmbed) {
+func sendEmbed(s Responder, i *discordgo.InteractionCreate, e []*discordgo.MessageEmbed) {
 	// Respond to the interaction with the first embed
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Embeds: e,
@@ -59,15 +114,78 @@ func sendEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, e []*discor
 }
 
 // sendMsg sends a message to the user who sent the command
-func sendMsg(s *discordgo.Session, i *discordgo.InteractionCreate, m string) {
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+func sendMsg(s Responder, i *discordgo.InteractionCreate, m string) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: m,
+		},
+	})
+}
+
+// optionUser returns the user a user option refers to, from the users Discord resolved along with the interaction
+func optionUser(i *discordgo.InteractionCreate, o *discordgo.ApplicationCommandInteractionDataOption) *discordgo.User {
+	id := o.Value.(string)
+	if resolved := i.ApplicationCommandData().Resolved; resolved != nil {
+		if u, ok := resolved.Users[id]; ok {
+			return u
+		}
+	}
+	return &discordgo.User{ID: id}
+}
+
+// sendEphemeral sends a message that only the user who triggered the interaction can see
+func sendEphemeral(s Responder, i *discordgo.InteractionCreate, m string) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: m,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// sendData sends a fully built interaction response, for replies that carry more than embeds such as components
+func sendData(s Responder, i *discordgo.InteractionCreate, d *discordgo.InteractionResponseData) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: d,
+	})
+}
+
+// sendFile sends an ephemeral message with a file attached to the user who sent the command
+func sendFile(s Responder, i *discordgo.InteractionCreate, m string, f *discordgo.File) {
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Content: m,
+			Files:   []*discordgo.File{f},
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// sendChoices answers an autocomplete interaction with the values to suggest
+func sendChoices(s Responder, i *discordgo.InteractionCreate, c []*discordgo.ApplicationCommandOptionChoice) {
+	if c == nil {
+		c = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: c,
 		},
 	})
 }
 
+// updateMsg replaces the message a component is attached to
+func updateMsg(s Responder, i *discordgo.InteractionCreate, d *discordgo.InteractionResponseData) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: d,
+	})
+}
+
 // ctxWithTimeout creates a context with the default database timeout.
 func ctxWithTimeout() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), dbTimeout)
@@ -59,3 +59,70 @@ func TestCtxWithTimeout(t *testing.T) {
 		t.Errorf("unexpected deadline remaining: %v (want 0 < remaining <= %v)", remaining, dbTimeout)
 	}
 }
+
+func TestFormatLeaderboard(t *testing.T) {
+	lb := formatLeaderboard([]leaderboardEntry{
+		{User: "<@1>", Count: 5},
+		{User: "<@2>", Count: 3},
+	})
+
+	want := "`1:` <@1>: 5\n`2:` <@2>: 3"
+	if lb != want {
+		t.Errorf("formatLeaderboard = %q, want %q", lb, want)
+	}
+
+	if lb := formatLeaderboard(nil); lb != "" {
+		t.Errorf("formatLeaderboard(nil) = %q, want empty", lb)
+	}
+}
+
+func TestQuoteFieldsSource(t *testing.T) {
+	q := Quote{
+		Quote:     "saved from chat",
+		Quotee:    "<@123>",
+		Quoter:    "<@456>",
+		CreatedAt: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		GuildID:   "1",
+		ChannelID: "2",
+		MessageID: "3",
+	}
+
+	fields := quoteFields(q)
+	if len(fields) != 5 {
+		t.Fatalf("expected 5 fields, got %d", len(fields))
+	}
+	if want := "https://discord.com/channels/1/2/3"; fields[4].Name != "Source" || fields[4].Value != want {
+		t.Errorf("source field = %q: %q, want Source: %q", fields[4].Name, fields[4].Value, want)
+	}
+}
+
+func TestCanModify(t *testing.T) {
+	t.Setenv("DISC_BOT_OWNER_ID", "999")
+	q := Quote{Quotee: "<@1>", Quoter: "<@2>"}
+
+	cases := []struct {
+		user string
+		want bool
+	}{
+		{"1", true},
+		{"2", true},
+		{"999", true},
+		{"3", false},
+	}
+	for _, c := range cases {
+		if got := canModify(q, c.user); got != c.want {
+			t.Errorf("canModify(user %s) = %v, want %v", c.user, got, c.want)
+		}
+	}
+}
+
+func TestQuoteEmbed(t *testing.T) {
+	e := quoteEmbed("Random Quote", Quote{ID: 123, Quote: "q", Quotee: "<@1>", Quoter: "<@2>"})
+
+	if e.Title != "Random Quote #123" {
+		t.Errorf("Title = %q, want %q", e.Title, "Random Quote #123")
+	}
+	if len(e.Fields) != 4 {
+		t.Errorf("expected the quote fields, got %d fields", len(e.Fields))
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxReportedRejections caps how many rejected rows an import summary lists individually
+const maxReportedRejections = 10
+
+const (
+	// maxImportSize is the largest import file downloaded, far more than any collection needs
+	maxImportSize = 10 << 20
+	// downloadTimeout bounds fetching an import file, leaving the rest of importTimeout for inserting its rows
+	downloadTimeout = time.Minute
+)
+
+// errImportTooLarge is returned for import files over maxImportSize. Its message is meant to be shown to the user.
+var errImportTooLarge = fmt.Errorf("import files can be at most %d MB", maxImportSize>>20)
+
+// importClient downloads import files
+var importClient = &http.Client{Timeout: downloadTimeout}
+
+// importRow is one quote read from an import file, before it is validated. Keys are lower-cased column names.
+type importRow struct {
+	Line   int
+	Fields map[string]string
+}
+
+// importRejection is a row that could not be imported and why
+type importRejection struct {
+	Line   int
+	Reason string
+}
+
+// importSummary reports what an import did with every row it read
+type importSummary struct {
+	Inserted int
+	Skipped  int
+	Rejected []importRejection
+}
+
+// String renders the summary for a Discord message or the terminal
+func (s importSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Inserted %d, skipped %d duplicates, rejected %d", s.Inserted, s.Skipped, len(s.Rejected))
+	for x, r := range s.Rejected {
+		if x == maxReportedRejections {
+			fmt.Fprintf(&b, "\n...and %d more", len(s.Rejected)-x)
+			break
+		}
+		fmt.Fprintf(&b, "\nRow %d: %s", r.Line, r.Reason)
+	}
+	return b.String()
+}
+
+// importFormatFromName picks the import format from a file extension
+func importFormatFromName(name string) (exportFormat, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return formatJSON, nil
+	case ".csv":
+		return formatCSV, nil
+	default:
+		return "", fmt.Errorf("cannot import %q: expected a .json or .csv file", name)
+	}
+}
+
+// downloadImport fetches an attached import file from Discord's CDN and reads its rows. Files over maxImportSize are
+// refused with errImportTooLarge.
+func downloadImport(ctx context.Context, url string, format exportFormat) ([]importRow, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := importClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading import: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading import: %s", resp.Status)
+	}
+	if resp.ContentLength > maxImportSize {
+		return nil, errImportTooLarge
+	}
+
+	// read one byte past the limit to tell a file of exactly maxImportSize from a longer one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading import: %w", err)
+	}
+	if len(body) > maxImportSize {
+		return nil, errImportTooLarge
+	}
+	return readImport(bytes.NewReader(body), format)
+}
+
+// readImport reads every row of a JSON or CSV import file
+func readImport(r io.Reader, format exportFormat) ([]importRow, error) {
+	switch format {
+	case formatJSON:
+		return readJSONImport(r)
+	case formatCSV:
+		return readCSVImport(r)
+	default:
+		return nil, fmt.Errorf("cannot import format %q", format)
+	}
+}
+
+// readJSONImport reads an array of objects. Values may be strings or numbers, such as Unix timestamps, and arrays
+// such as tags are joined with commas.
+func readJSONImport(r io.Reader) ([]importRow, error) {
+	var objects []map[string]any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&objects); err != nil {
+		return nil, fmt.Errorf("error reading JSON: %w", err)
+	}
+
+	rows := make([]importRow, 0, len(objects))
+	for x, obj := range objects {
+		fields := make(map[string]string, len(obj))
+		for k, v := range obj {
+			switch v := v.(type) {
+			case nil:
+			case []any:
+				parts := make([]string, 0, len(v))
+				for _, part := range v {
+					parts = append(parts, fmt.Sprint(part))
+				}
+				fields[strings.ToLower(k)] = strings.Join(parts, ",")
+			default:
+				fields[strings.ToLower(k)] = fmt.Sprint(v)
+			}
+		}
+		rows = append(rows, importRow{Line: x + 1, Fields: fields})
+	}
+	return rows, nil
+}
+
+// readCSVImport reads a CSV file whose first row names the columns
+func readCSVImport(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	for x := range header {
+		header[x] = strings.ToLower(strings.TrimSpace(header[x]))
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %w", err)
+		}
+
+		fields := make(map[string]string, len(header))
+		for x, value := range record {
+			if x < len(header) {
+				fields[header[x]] = value
+			}
+		}
+		rows = append(rows, importRow{Line: line, Fields: fields})
+	}
+	return rows, nil
+}
+
+// mentionPattern matches a user mention or a bare snowflake
+var mentionPattern = regexp.MustCompile(`^(?:<@!?(\d{15,21})>|(\d{15,21}))$`)
+
+// normalizeMention turns a mention or user ID into the <@id> form the collection stores
+func normalizeMention(s string) (string, bool) {
+	m := mentionPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return "", false
+	}
+	return fmt.Sprintf("<@%s%s>", m[1], m[2]), true
+}
+
+// importTimeLayouts are the timestamp layouts accepted besides Unix seconds and milliseconds
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	time.RFC822,
+	time.RFC1123,
+}
+
+// parseImportTime parses the original timestamp of an imported quote. Zone-less layouts are read as UTC.
+func parseImportTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		// anything past 1e11 seconds is far in the future, so it must be milliseconds
+		if n > 1e11 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+
+	for _, layout := range importTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// toQuote validates a row and builds the quote it describes. guild overrides any guild column in the row.
+func (r importRow) toQuote(guild string) (Quote, error) {
+	text := strings.TrimSpace(r.Fields["quote"])
+	if text == "" {
+		return Quote{}, errors.New("quote is empty")
+	}
+
+	quotee, ok := normalizeMention(r.Fields["quotee"])
+	if !ok {
+		return Quote{}, fmt.Errorf("quotee %q is not a user mention or ID", r.Fields["quotee"])
+	}
+	quoter, ok := normalizeMention(r.Fields["quoter"])
+	if !ok {
+		return Quote{}, fmt.Errorf("quoter %q is not a user mention or ID", r.Fields["quoter"])
+	}
+
+	if r.Fields["createdat"] == "" {
+		return Quote{}, errors.New("createdAt is missing")
+	}
+	createdAt, err := parseImportTime(r.Fields["createdat"])
+	if err != nil {
+		return Quote{}, err
+	}
+
+	tags, err := parseTags(r.Fields["tags"])
+	if err != nil {
+		return Quote{}, err
+	}
+
+	if guild == "" {
+		guild = r.Fields["guild"]
+	}
+	if guild == "" {
+		return Quote{}, errors.New("no guild given for the quote")
+	}
+
+	return Quote{
+		Quote:     text,
+		Quotee:    quotee,
+		Quoter:    quoter,
+		CreatedAt: createdAt,
+		GuildID:   guild,
+		ChannelID: r.Fields["channelid"],
+		MessageID: r.Fields["messageid"],
+		Tags:      tags,
+	}, nil
+}
+
+// dedupeKey identifies a quote for duplicate detection. IDs are ignored because imports are always renumbered.
+func dedupeKey(q Quote) string {
+	return strings.Join([]string{q.GuildID, q.Quote, q.Quotee, q.Quoter, q.CreatedAt.UTC().Format(time.RFC3339Nano)}, "\x00")
+}
+
+// importQuotes inserts every valid row that is not already in the collection or earlier in the file. guild
+// assigns every row to one guild; when empty, each row must name its own.
+func importQuotes(ctx context.Context, db QuoteStore, rows []importRow, guild string) (importSummary, error) {
+	var summary importSummary
+
+	existing, err := db.listQuotes(ctx, guild)
+	if err != nil {
+		return summary, fmt.Errorf("error listing existing quotes: %w", err)
+	}
+	seen := make(map[string]bool, len(existing)+len(rows))
+	for _, q := range existing {
+		seen[dedupeKey(q)] = true
+	}
+
+	for _, row := range rows {
+		q, err := row.toQuote(guild)
+		if err != nil {
+			summary.Rejected = append(summary.Rejected, importRejection{Line: row.Line, Reason: err.Error()})
+			continue
+		}
+
+		key := dedupeKey(q)
+		if seen[key] {
+			summary.Skipped++
+			continue
+		}
+
+		if _, err := db.createQuote(ctx, q); err != nil {
+			return summary, fmt.Errorf("error inserting row %d: %w", row.Line, err)
+		}
+		seen[key] = true
+		summary.Inserted++
+	}
+
+	return summary, nil
+}
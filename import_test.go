@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeMention(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"<@123456789012345678>", "<@123456789012345678>", true},
+		{"<@!123456789012345678>", "<@123456789012345678>", true},
+		{" 123456789012345678 ", "<@123456789012345678>", true},
+		{"Tilt", "", false},
+		{"<@12>", "", false},
+	}
+	for _, c := range cases {
+		got, ok := normalizeMention(c.in)
+		if got != c.want || ok != c.ok {
+			t.Errorf("normalizeMention(%q) = %q, %v, want %q, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestParseImportTime(t *testing.T) {
+	want := time.Date(2021, 6, 1, 18, 30, 0, 0, time.UTC)
+	for _, in := range []string{"2021-06-01T18:30:00Z", "2021-06-01 18:30:00", "1622572200", "1622572200000"} {
+		got, err := parseImportTime(in)
+		if err != nil {
+			t.Errorf("parseImportTime(%q): %v", in, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseImportTime(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	if _, err := parseImportTime("last tuesday"); err == nil {
+		t.Error("expected error for unrecognised timestamp")
+	}
+}
+
+func TestImportQuotes(t *testing.T) {
+	db := newMemStore()
+	ctx := context.Background()
+
+	// already in the collection, so the matching row must be skipped
+	_, err := db.createQuote(ctx, Quote{Quote: "old", Quotee: "<@111111111111111111>", Quoter: "<@222222222222222222>",
+		CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), GuildID: testGuild})
+	if err != nil {
+		t.Fatalf("createQuote: %v", err)
+	}
+
+	csvFile := `Quote,Quotee,Quoter,CreatedAt
+old,111111111111111111,<@222222222222222222>,2020-01-01T00:00:00Z
+new,<@!111111111111111111>,222222222222222222,2020-02-01
+new,111111111111111111,222222222222222222,2020-02-01T00:00:00Z
+,111111111111111111,222222222222222222,2020-02-01
+named,Tilt,222222222222222222,2020-02-01
+undated,111111111111111111,222222222222222222,
+`
+	rows, err := readImport(strings.NewReader(csvFile), formatCSV)
+	if err != nil {
+		t.Fatalf("readImport: %v", err)
+	}
+
+	summary, err := importQuotes(ctx, db, rows, testGuild)
+	if err != nil {
+		t.Fatalf("importQuotes: %v", err)
+	}
+	if summary.Inserted != 1 || summary.Skipped != 2 || len(summary.Rejected) != 3 {
+		t.Fatalf("summary = %+v, want 1 inserted, 2 skipped, 3 rejected", summary)
+	}
+	if summary.Rejected[1].Line != 6 || !strings.Contains(summary.Rejected[1].Reason, "Tilt") {
+		t.Errorf("second rejection = %+v, want row 6 naming the bad quotee", summary.Rejected[1])
+	}
+
+	q, err := db.getLatestQuote(ctx, testGuild)
+	if err != nil {
+		t.Fatalf("getLatestQuote: %v", err)
+	}
+	want := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	if q.Quote != "new" || q.Quotee != "<@111111111111111111>" || !q.CreatedAt.Equal(want) {
+		t.Errorf("imported quote = %+v, want the original timestamp and a mention", q)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	quotes := []Quote{
+		{ID: 1, Quote: "first", Quotee: "<@111111111111111111>", Quoter: "<@222222222222222222>",
+			CreatedAt: time.Date(2022, 5, 4, 3, 2, 1, 0, time.UTC), GuildID: testGuild, ChannelID: "10", MessageID: "20",
+			Tags: []string{"in-jokes", "work"}},
+		{ID: 2, Quote: "second, \"with\" quotes", Quotee: "<@222222222222222222>", Quoter: "<@111111111111111111>",
+			CreatedAt: time.Date(2022, 5, 5, 0, 0, 0, 123000000, time.UTC), GuildID: testGuild},
+	}
+
+	for _, format := range []exportFormat{formatJSON, formatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeExport(&buf, format, quotes, "quotes", dialectSQLite); err != nil {
+				t.Fatalf("writeExport: %v", err)
+			}
+			rows, err := readImport(&buf, format)
+			if err != nil {
+				t.Fatalf("readImport: %v", err)
+			}
+
+			// no guild given, so each row keeps the guild it was exported from
+			db := newMemStore()
+			summary, err := importQuotes(ctx, db, rows, "")
+			if err != nil {
+				t.Fatalf("importQuotes: %v", err)
+			}
+			if summary.Inserted != 2 {
+				t.Fatalf("summary = %+v, want 2 inserted", summary)
+			}
+
+			imported, err := db.listQuotes(ctx, testGuild)
+			if err != nil {
+				t.Fatalf("listQuotes: %v", err)
+			}
+			assertSameQuotes(t, imported, quotes)
+
+			// importing the same file again changes nothing
+			summary, err = importQuotes(ctx, db, rows, "")
+			if err != nil {
+				t.Fatalf("second importQuotes: %v", err)
+			}
+			if summary.Inserted != 0 || summary.Skipped != 2 {
+				t.Errorf("second import summary = %+v, want everything skipped", summary)
+			}
+		})
+	}
+}
+
+func TestImportTags(t *testing.T) {
+	csvFile := `quote,quotee,quoter,createdAt,tags
+tagged,111111111111111111,222222222222222222,2020-02-01,"Work, in jokes"
+untagged,111111111111111111,222222222222222222,2020-02-02,
+bad,111111111111111111,222222222222222222,2020-02-03,wow!
+`
+	jsonFile := `[{"quote": "listed", "quotee": "111111111111111111", "quoter": "222222222222222222", "createdAt": "2020-02-04", "tags": ["work", "Funny"]}]`
+
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		for _, file := range []struct {
+			format exportFormat
+			body   string
+		}{{formatCSV, csvFile}, {formatJSON, jsonFile}} {
+			rows, err := readImport(strings.NewReader(file.body), file.format)
+			if err != nil {
+				t.Fatalf("readImport %s: %v", file.format, err)
+			}
+			if _, err := importQuotes(ctx, conn, rows, testGuild); err != nil {
+				t.Fatalf("importQuotes %s: %v", file.format, err)
+			}
+		}
+
+		quotes, err := conn.listQuotes(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("listQuotes: %v", err)
+		}
+		var got []string
+		for _, q := range quotes {
+			got = append(got, q.Quote+":"+strings.Join(q.Tags, ","))
+		}
+		// the row with a bad tag is rejected rather than imported without it
+		if want := "tagged:in-jokes,work untagged: listed:funny,work"; strings.Join(got, " ") != want {
+			t.Errorf("imported %q, want %q", strings.Join(got, " "), want)
+		}
+
+		tags, err := conn.listTags(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("listTags: %v", err)
+		}
+		if len(tags) != 3 || tags[0] != (tagCount{Name: "work", Count: 2}) {
+			t.Errorf("listTags = %+v, want work on 2 quotes first", tags)
+		}
+	})
+}
+
+func TestDownloadImport(t *testing.T) {
+	const csvFile = "quote,quotee,quoter,createdAt\nsmall,111111111111111111,222222222222222222,2020-02-01\n"
+	oversize := strings.Repeat("x", maxImportSize+1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small.csv":
+			w.Write([]byte(csvFile))
+		case "/declared.csv":
+			w.Write([]byte(oversize))
+		case "/streamed.csv":
+			// flushing first sends the body chunked, without a length to refuse it by up front
+			w.(http.Flusher).Flush()
+			w.Write([]byte(oversize))
+		}
+	}))
+	defer srv.Close()
+
+	rows, err := downloadImport(context.Background(), srv.URL+"/small.csv", formatCSV)
+	if err != nil || len(rows) != 1 || rows[0].Fields["quote"] != "small" {
+		t.Errorf("downloadImport = %+v, %v; want the one row", rows, err)
+	}
+	for _, path := range []string{"/declared.csv", "/streamed.csv"} {
+		if _, err := downloadImport(context.Background(), srv.URL+path, formatCSV); !errors.Is(err, errImportTooLarge) {
+			t.Errorf("downloadImport %s: err = %v, want errImportTooLarge", path, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// leaderboardMode chooses who a leaderboard ranks
+type leaderboardMode string
+
+const (
+	rankQuotees leaderboardMode = "quotee"
+	rankQuoters leaderboardMode = "quoter"
+)
+
+// column returns the quote column holding the users the mode ranks
+func (m leaderboardMode) column() string {
+	if m == rankQuoters {
+		return "quoter"
+	}
+	return "quotee"
+}
+
+// leaderboardPeriod is a preset window of time ending now
+type leaderboardPeriod string
+
+const (
+	periodWeek    leaderboardPeriod = "week"
+	periodMonth   leaderboardPeriod = "month"
+	periodYear    leaderboardPeriod = "year"
+	periodAllTime leaderboardPeriod = "all-time"
+)
+
+// leaderboardQuery selects the quotes a leaderboard counts: those created from From up to but not including To,
+// ranked by Mode. A zero From or To leaves that end of the window open.
+type leaderboardQuery struct {
+	Mode     leaderboardMode
+	From, To time.Time
+	// Label names the window for people, such as "Past week"
+	Label string
+}
+
+// includes reports whether a quote created at t falls inside the window
+func (q leaderboardQuery) includes(t time.Time) bool {
+	return (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || t.Before(q.To))
+}
+
+// newLeaderboardQuery builds a leaderboard query from a preset period or a custom range of dates. from and to are
+// dates such as 2024-01-31 in loc, and to is inclusive. Errors are meant to be shown to the user.
+func newLeaderboardQuery(mode leaderboardMode, period leaderboardPeriod, from, to string, now time.Time, loc *time.Location) (leaderboardQuery, error) {
+	q := leaderboardQuery{Mode: mode}
+	switch mode {
+	case "":
+		q.Mode = rankQuotees
+	case rankQuotees, rankQuoters:
+	default:
+		return q, fmt.Errorf("mode must be %s or %s", rankQuotees, rankQuoters)
+	}
+
+	if from != "" || to != "" {
+		if period != "" {
+			return q, errors.New("choose a period or a date range, not both")
+		}
+		return q.withRange(from, to, loc)
+	}
+
+	switch period {
+	case periodWeek:
+		q.From, q.Label = now.AddDate(0, 0, -7), "Past week"
+	case periodMonth:
+		q.From, q.Label = now.AddDate(0, -1, 0), "Past month"
+	case periodYear:
+		q.From, q.Label = now.AddDate(-1, 0, 0), "Past year"
+	case periodAllTime, "":
+		q.Label = "All-time"
+	default:
+		return q, fmt.Errorf("period must be %s, %s, %s or %s", periodWeek, periodMonth, periodYear, periodAllTime)
+	}
+	return q, nil
+}
+
+// withRange sets the window to the days from and to, either of which may be empty
+func (q leaderboardQuery) withRange(from, to string, loc *time.Location) (leaderboardQuery, error) {
+	const display = "Jan 2, 2006"
+
+	if from != "" {
+		day, err := time.ParseInLocation(time.DateOnly, from, loc)
+		if err != nil {
+			return q, fmt.Errorf("from must be a date such as 2024-01-31, not %q", from)
+		}
+		q.From, q.Label = day, "Since "+day.Format(display)
+	}
+	if to != "" {
+		day, err := time.ParseInLocation(time.DateOnly, to, loc)
+		if err != nil {
+			return q, fmt.Errorf("to must be a date such as 2024-12-31, not %q", to)
+		}
+		q.To, q.Label = day.AddDate(0, 0, 1), "Until "+day.Format(display)
+	}
+
+	if from != "" && to != "" {
+		if !q.From.Before(q.To) {
+			return q, errors.New("the date range must start on or before the day it ends")
+		}
+		q.Label = q.From.Format(display) + " to " + q.To.AddDate(0, 0, -1).Format(display)
+	}
+	return q, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewLeaderboardQuery(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, loc)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, loc) }
+
+	tests := []struct {
+		name     string
+		mode     leaderboardMode
+		period   leaderboardPeriod
+		from, to string
+		want     leaderboardQuery
+		wantErr  string
+	}{
+		{name: "defaults", want: leaderboardQuery{Mode: rankQuotees, Label: "All-time"}},
+		{name: "week", period: periodWeek, want: leaderboardQuery{Mode: rankQuotees, From: now.AddDate(0, 0, -7), Label: "Past week"}},
+		{name: "month of quoters", mode: rankQuoters, period: periodMonth, want: leaderboardQuery{Mode: rankQuoters, From: day(2024, 2, 15).Add(12 * time.Hour), Label: "Past month"}},
+		{name: "year", period: periodYear, want: leaderboardQuery{Mode: rankQuotees, From: now.AddDate(-1, 0, 0), Label: "Past year"}},
+		{name: "range", from: "2024-01-01", to: "2024-01-31", want: leaderboardQuery{Mode: rankQuotees, From: day(2024, 1, 1), To: day(2024, 2, 1), Label: "Jan 1, 2024 to Jan 31, 2024"}},
+		{name: "single day", from: "2024-01-01", to: "2024-01-01", want: leaderboardQuery{Mode: rankQuotees, From: day(2024, 1, 1), To: day(2024, 1, 2), Label: "Jan 1, 2024 to Jan 1, 2024"}},
+		{name: "open start", to: "2023-12-31", want: leaderboardQuery{Mode: rankQuotees, To: day(2024, 1, 1), Label: "Until Dec 31, 2023"}},
+		{name: "open end", from: "2024-02-29", want: leaderboardQuery{Mode: rankQuotees, From: day(2024, 2, 29), Label: "Since Feb 29, 2024"}},
+		{name: "period and range", period: periodWeek, from: "2024-01-01", wantErr: "choose a period or a date range, not both"},
+		{name: "backwards range", from: "2024-02-01", to: "2024-01-01", wantErr: "the date range must start on or before the day it ends"},
+		{name: "bad date", from: "01/02/2024", wantErr: `from must be a date such as 2024-01-31, not "01/02/2024"`},
+		{name: "bad period", period: "decade", wantErr: "period must be week, month, year or all-time"},
+		{name: "bad mode", mode: "speaker", wantErr: "mode must be quotee or quoter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newLeaderboardQuery(tt.mode, tt.period, tt.from, tt.to, now, loc)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newLeaderboardQuery: %v", err)
+			}
+			if got.Mode != tt.want.Mode || !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) || got.Label != tt.want.Label {
+				t.Errorf("query = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
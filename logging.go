@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// logAttrsKey is the context key of the attributes contextHandler adds to every line logged with that context
+type logAttrsKey struct{}
+
+// contextHandler adds the attributes stored in a record's context by withLogAttrs, so code that only has a context,
+// such as the database methods, still logs which interaction it is serving
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// newLogHandler builds the handler selected by LOG_FORMAT, json by default or text, logging at LOG_LEVEL and above
+func newLogHandler(w io.Writer) (slog.Handler, error) {
+	var level slog.Level
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT must be json or text, not %q", format)
+	}
+}
+
+// setupLogging sends every log line, including those of the standard log package, to a structured handler on
+// standard error
+func setupLogging() error {
+	h, err := newLogHandler(os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// withLogAttrs returns a context whose log lines carry attrs as well as any attributes ctx already has
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(existing[:len(existing):len(existing)], attrs...))
+}
+
+// correlationID identifies an interaction in the logs. Discord's interaction ID is already unique, so users can
+// quote it when they report a problem.
+func correlationID(i *discordgo.InteractionCreate) string {
+	return i.ID
+}
+
+// interactionUser returns the ID of the user who triggered an interaction, in a guild or a DM
+func interactionUser(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// withInteraction returns a context whose log lines carry the interaction's correlation ID, guild, user and command
+func withInteraction(ctx context.Context, i *discordgo.InteractionCreate) context.Context {
+	return withLogAttrs(ctx,
+		slog.String("interaction", correlationID(i)),
+		slog.String("guild", i.GuildID),
+		slog.String("user", interactionUser(i)),
+		slog.String("command", commandName(i)),
+	)
+}
+
+// interactionCtx creates a context with the default database timeout that logs on behalf of an interaction
+func interactionCtx(i *discordgo.InteractionCreate) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(withInteraction(context.Background(), i), dbTimeout)
+}
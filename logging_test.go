@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// decodeLogLine parses the single JSON log line in buf
+func decodeLogLine(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode log line %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestInteractionLogAttrs(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "json")
+	t.Setenv("LOG_LEVEL", "debug")
+
+	var buf bytes.Buffer
+	h, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatalf("newLogHandler: %v", err)
+	}
+
+	i := commandInteraction("quote", "add")
+	i.ID = "900"
+	i.GuildID = testGuild
+	i.Member = &discordgo.Member{User: &discordgo.User{ID: "42"}}
+
+	slog.New(h).DebugContext(withInteraction(context.Background(), i), "creating quote", "quotee", "<@1>")
+
+	line := decodeLogLine(t, &buf)
+	want := map[string]string{
+		"msg":         "creating quote",
+		"level":       "DEBUG",
+		"interaction": "900",
+		"guild":       testGuild,
+		"user":        "42",
+		"command":     "quote add",
+		"quotee":      "<@1>",
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %q", key, line[key], value)
+		}
+	}
+}
+
+func TestWithLogAttrsDoesNotShare(t *testing.T) {
+	base := withLogAttrs(context.Background(), slog.String("a", "1"))
+	first := withLogAttrs(base, slog.String("b", "2"))
+	second := withLogAttrs(base, slog.String("c", "3"))
+
+	if attrs := first.Value(logAttrsKey{}).([]slog.Attr); len(attrs) != 2 || attrs[1].Key != "b" {
+		t.Errorf("first attrs = %v", attrs)
+	}
+	if attrs := second.Value(logAttrsKey{}).([]slog.Attr); len(attrs) != 2 || attrs[1].Key != "c" {
+		t.Errorf("second attrs = %v", attrs)
+	}
+}
+
+func TestNewLogHandlerConfig(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("LOG_FORMAT", "text")
+	var buf bytes.Buffer
+	h, err := newLogHandler(&buf)
+	if err != nil {
+		t.Fatalf("newLogHandler: %v", err)
+	}
+	if h.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info should be disabled at LOG_LEVEL=warn")
+	}
+
+	t.Setenv("LOG_LEVEL", "loud")
+	if _, err := newLogHandler(&buf); err == nil {
+		t.Error("expected an error for an unknown LOG_LEVEL")
+	}
+
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "xml")
+	if _, err := newLogHandler(&buf); err == nil {
+		t.Error("expected an error for an unknown LOG_FORMAT")
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,22 +17,42 @@ import (
 
 // validateEnv checks that all required environment variables are set and fatals if any are missing.
 func validateEnv() {
-	required := []string{"DISCORD_TOKEN", "DISCORD_GUILD", "DISC_BOT_OWNER_ID", "SQLITE_DB", "SQLITE_TABLE_NAME"}
-	for _, key := range required {
+	requireEnv(append([]string{"DISCORD_TOKEN", "DISC_BOT_OWNER_ID"}, dbEnv()...)...)
+}
+
+// dbEnv returns the environment variables the configured database backend needs.
+func dbEnv() []string {
+	if dialect(os.Getenv("DB_DRIVER")) == dialectPostgres {
+		return []string{"POSTGRES_DSN", "POSTGRES_TABLE_NAME"}
+	}
+	return []string{"SQLITE_DB", "SQLITE_TABLE_NAME"}
+}
+
+// requireEnv fatals if any of the environment variables is not set.
+func requireEnv(keys ...string) {
+	for _, key := range keys {
 		if os.Getenv(key) == "" {
-			log.Fatalf("Required environment variable %s is not set", key)
+			fatal("required environment variable is not set", "key", key)
 		}
 	}
 }
 
-// setCommands registers commands to Discord in an overwrite fashion.
+// setCommands registers commands globally to Discord in an overwrite fashion so every guild the bot joins can use them.
 func setCommands(s *discordgo.Session) error {
-	log.Println("Adding commands...")
-	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, os.Getenv("DISCORD_GUILD"), commands)
+	slog.Info("registering commands")
+	_, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", commands)
 	if err != nil {
 		return fmt.Errorf("error in command creation: %w", err)
 	}
-	log.Println("All commands successfully registered (overwrite)")
+
+	// commands used to be registered to a single guild; clear them so that guild doesn't list every command twice
+	if guild := os.Getenv("DISCORD_GUILD"); guild != "" {
+		_, err = s.ApplicationCommandBulkOverwrite(s.State.User.ID, guild, []*discordgo.ApplicationCommand{})
+		if err != nil {
+			return fmt.Errorf("error clearing legacy guild commands: %w", err)
+		}
+	}
+	slog.Info("all commands registered", "count", len(commands))
 	return nil
 }
 
@@ -38,48 +62,121 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
+	if err := setupLogging(); err != nil {
+		log.Fatalln(err)
+	}
+
+	// any arguments select a command line mode, such as export, instead of running the bot
+	if len(os.Args) > 1 {
+		if err := runCLI(os.Args[1:]); err != nil {
+			fatal("command failed", "command", os.Args[1], "err", err)
+		}
+		return
+	}
 
 	validateEnv()
 
-	db, err := newSQLConn()
-	if err != nil {
-		log.Fatalf("Cannot connect to the database: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runBot(ctx); err != nil {
+		fatal("bot stopped", "err", err)
 	}
-	defer db.Conn.Close()
+}
 
+// newSession creates the bot's Discord session. DISCORD_API_URL sends its requests to another server, such as the
+// stand-in Discord the end-to-end tests run, which then also chooses the gateway the session connects to.
+func newSession() (*discordgo.Session, error) {
 	session, err := discordgo.New("Bot " + os.Getenv("DISCORD_TOKEN"))
 	if err != nil {
-		log.Fatalf("Cannot create a Discord session: %v", err)
+		return nil, err
+	}
+
+	if base := os.Getenv("DISCORD_API_URL"); base != "" {
+		u, err := url.Parse(base)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("DISCORD_API_URL must be an absolute URL, not %q", base)
+		}
+		session.Client = &http.Client{
+			Timeout:   session.Client.Timeout,
+			Transport: redirectTransport{to: u, next: http.DefaultTransport},
+		}
+	}
+	return session, nil
+}
+
+// redirectTransport sends every request to another scheme and host, keeping its path
+type redirectTransport struct {
+	to   *url.URL
+	next http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = t.to.Scheme, t.to.Host, t.to.Host
+	return t.next.RoundTrip(r)
+}
+
+// runBot connects to Discord and answers interactions until ctx is cancelled
+func runBot(ctx context.Context) error {
+	db, err := openStore()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the database: %w", err)
+	}
+	defer db.Close()
+
+	session, err := newSession()
+	if err != nil {
+		return fmt.Errorf("cannot create a Discord session: %w", err)
 	}
 
 	handlerCtx = &HandlerContext{
-		Session: session,
-		DB:      db,
+		Discord:    session,
+		DB:         db,
+		Searches:   newSearchCache(),
+		Limiter:    newRateLimiter(rateBurst, rateInterval),
+		AlertOwner: ownerDM(session),
+		LookupUser: discordUsers(session),
 	}
 
 	session.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
-		log.Printf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
+		slog.Info("logged in", "user", s.State.User.Username+"#"+s.State.User.Discriminator)
+	})
+	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		handleInteraction(handlerCtx, i)
 	})
 
 	if err = session.Open(); err != nil {
-		log.Fatalf("Cannot open the session: %v", err)
+		return fmt.Errorf("cannot open the session: %w", err)
 	}
+	defer session.Close()
 
 	if err = setCommands(session); err != nil {
-		log.Fatalln(err)
+		return fmt.Errorf("cannot register commands: %w", err)
 	}
 
-	session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := commandHandlers[i.ApplicationCommandData().Name]; ok {
-			h(handlerCtx, i)
-		}
-	})
+	api, err := startAPI(db)
+	if err != nil {
+		return fmt.Errorf("cannot start the API: %w", err)
+	}
+	defer shutdownServer(api)
 
-	defer session.Close()
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
-	log.Println("Running version ", os.Getenv("VERSION"))
-	log.Println("Stop the container or press Ctrl+C to exit")
-	<-stop
-	log.Printf("Gracefully disconnected: %v#%v", session.State.User.Username, session.State.User.Discriminator)
+	metrics, err := startMetrics(db)
+	if err != nil {
+		return fmt.Errorf("cannot start the metrics server: %w", err)
+	}
+	defer shutdownServer(metrics)
+
+	sched, err := loadDailySchedule()
+	if err != nil {
+		return fmt.Errorf("invalid quote of the day schedule: %w", err)
+	}
+	if len(sched.Channels) > 0 {
+		go runDailyQuotes(ctx, session, db, sched)
+	}
+
+	slog.Info("running", "version", os.Getenv("VERSION"))
+	slog.Info("stop the container or press Ctrl+C to exit")
+	<-ctx.Done()
+	slog.Info("gracefully disconnected", "user", session.State.User.Username+"#"+session.State.User.Discriminator)
+	return nil
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// TestBotEndToEnd runs the bot against a fake Discord: it must register its commands, answer interactions over
+// REST and disconnect when stopped
+func TestBotEndToEnd(t *testing.T) {
+	discord := newFakeDiscord(t)
+	t.Setenv("DISCORD_API_URL", discord.URL())
+	t.Setenv("DISCORD_TOKEN", "test-token")
+	t.Setenv("DISC_BOT_OWNER_ID", testOwner)
+	t.Setenv("DISCORD_GUILD", testGuild)
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("SQLITE_DB", filepath.Join(t.TempDir(), "quotes.db"))
+	t.Setenv("SQLITE_TABLE_NAME", "quotes")
+	for _, key := range []string{"API_ADDR", "METRICS_ADDR", "DAILY_QUOTE_CHANNELS"} {
+		t.Setenv(key, "")
+	}
+
+	stop := discord.start(runBot)
+
+	registered := discord.waitCommands("")
+	if len(registered) != len(commands) {
+		t.Fatalf("registered %d commands, want %d", len(registered), len(commands))
+	}
+	for x, cmd := range registered {
+		if cmd.Name != commands[x].Name || cmd.ApplicationID != fakeBotID {
+			t.Errorf("command %d = %q for application %s", x, cmd.Name, cmd.ApplicationID)
+		}
+	}
+	if legacy := discord.waitCommands(testGuild); len(legacy) != 0 {
+		t.Errorf("legacy guild commands = %v, want them cleared", legacy)
+	}
+
+	add := quoteInteraction(testUser, "add",
+		option("quote", discordgo.ApplicationCommandOptionString, "hello from the fake"),
+		option("quotee", discordgo.ApplicationCommandOptionUser, testOther),
+	)
+	calls := discord.waitCalls(discord.interact(add.Interaction), 1)
+	if calls[0].Type != discordgo.InteractionResponseChannelMessageWithSource || len(calls[0].Data.Embeds) != 1 ||
+		calls[0].Data.Embeds[0].Title != "Added Quote #1" {
+		t.Errorf("add replied %v %+v", calls[0], calls[0].Data)
+	}
+
+	calls = discord.waitCalls(discord.interact(quoteInteraction(testUser, "count").Interaction), 1)
+	if calls[0].Data.Content != "There are 1 quotes in the collection" {
+		t.Errorf("count replied %q", calls[0].Data.Content)
+	}
+
+	// cards show the quotee's avatar, looked up through the REST API and the CDN
+	calls = discord.waitCalls(discord.interact(quoteInteraction(testUser, "card", option("id", discordgo.ApplicationCommandOptionInteger, 1)).Interaction), 1)
+	if files := calls[0].Data.Files; len(files) != 1 || files[0].Name != "quote-1.png" {
+		t.Fatalf("card attached %+v", files)
+	}
+	card, err := png.Decode(calls[0].Data.Files[0].Reader)
+	if err != nil {
+		t.Fatalf("card is not a PNG: %v", err)
+	}
+	if got := color.RGBAModel.Convert(card.At(cardMargin+avatarSize/2, cardHeight/2)); got != fakeAvatarColor {
+		t.Errorf("avatar drawn as %v, want %v", got, fakeAvatarColor)
+	}
+
+	// exports defer and then attach the file to the deferred response
+	export := quoteInteraction(testOwner, "export", option("format", discordgo.ApplicationCommandOptionString, "json"))
+	calls = discord.waitCalls(discord.interact(export.Interaction), 2)
+	if calls[0].String() != respondDeferred || calls[1].Method != "edit" {
+		t.Fatalf("export calls = %v", calls)
+	}
+	if files := calls[1].Data.Files; len(files) != 1 || files[0].Name != "quotes-"+testGuild+".json" {
+		t.Errorf("export attached %+v", files)
+	}
+
+	if err := stop(); err != nil {
+		t.Errorf("runBot: %v", err)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memStore is an in-memory QuoteStore. Quotes are kept in insertion order, which is also ID order.
+type memStore struct {
+	mu     sync.Mutex
+	quotes []Quote
+	nextID int64
+	// daily holds the quote of the day picks by guild and day
+	daily map[string]map[string]dailyPick
+}
+
+// dailyPick is the quote picked for a day and the cycle it was picked in
+type dailyPick struct {
+	cycle int
+	id    int64
+}
+
+// newMemStore creates an empty in-memory quote store
+func newMemStore() *memStore {
+	return &memStore{}
+}
+
+// createQuote appends a quote to the store and returns its ID
+func (m *memStore) createQuote(ctx context.Context, quote Quote) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	quote.ID = m.nextID
+	m.quotes = append(m.quotes, quote)
+	return quote.ID, nil
+}
+
+// find returns the index of a quote in the store or -1. The caller must hold the lock.
+func (m *memStore) find(guild string, id int64) int {
+	for x, q := range m.quotes {
+		if q.GuildID == guild && q.ID == id {
+			return x
+		}
+	}
+	return -1
+}
+
+// getQuote gets a single quote by its ID
+func (m *memStore) getQuote(ctx context.Context, guild string, id int64) (Quote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	x := m.find(guild, id)
+	if x < 0 {
+		return Quote{}, fmt.Errorf("getQuote: %w", sql.ErrNoRows)
+	}
+	return m.quotes[x], nil
+}
+
+// editQuote applies an edit to a quote
+func (m *memStore) editQuote(ctx context.Context, guild string, id int64, edit quoteEdit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	x := m.find(guild, id)
+	if x < 0 {
+		return fmt.Errorf("editQuote: %w", sql.ErrNoRows)
+	}
+	if edit.Quote != "" {
+		m.quotes[x].Quote = edit.Quote
+	}
+	if edit.SetTags {
+		m.quotes[x].Tags = edit.Tags
+	}
+	return nil
+}
+
+// deleteQuote removes a quote
+func (m *memStore) deleteQuote(ctx context.Context, guild string, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	x := m.find(guild, id)
+	if x < 0 {
+		return fmt.Errorf("deleteQuote: %w", sql.ErrNoRows)
+	}
+	m.quotes = append(m.quotes[:x], m.quotes[x+1:]...)
+	return nil
+}
+
+// listTags counts the quotes with each of a guild's tags, most used first with ties in name order
+func (m *memStore) listTags(ctx context.Context, guild string) ([]tagCount, error) {
+	counts := make(map[string]int)
+	for _, q := range m.filter(byGuild(guild)) {
+		for _, tag := range q.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]tagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, tagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(a, b int) bool {
+		if tags[a].Count != tags[b].Count {
+			return tags[a].Count > tags[b].Count
+		}
+		return tags[a].Name < tags[b].Name
+	})
+	return tags, nil
+}
+
+// filter returns the quotes matching keep, oldest first
+func (m *memStore) filter(keep func(Quote) bool) []Quote {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var quotes []Quote
+	for _, q := range m.quotes {
+		if keep(q) {
+			quotes = append(quotes, q)
+		}
+	}
+	return quotes
+}
+
+// byGuild matches every quote in a guild
+func byGuild(guild string) func(Quote) bool {
+	return func(q Quote) bool { return q.GuildID == guild }
+}
+
+// byQuotee matches quotes in a guild spoken by the user with the given ID
+func byQuotee(guild string, quotee string) func(Quote) bool {
+	id := fmt.Sprintf("<@%s>", quotee)
+	return func(q Quote) bool { return q.GuildID == guild && q.Quotee == id }
+}
+
+// pickRandom returns a random quote from quotes or sql.ErrNoRows when there are none
+func pickRandom(quotes []Quote) (Quote, error) {
+	if len(quotes) == 0 {
+		return Quote{}, sql.ErrNoRows
+	}
+	return quotes[rand.IntN(len(quotes))], nil
+}
+
+// pickLatest returns the most recently created quote in quotes, the last added on a tie, or sql.ErrNoRows when there
+// are none
+func pickLatest(quotes []Quote) (Quote, error) {
+	if len(quotes) == 0 {
+		return Quote{}, sql.ErrNoRows
+	}
+	latest := quotes[0]
+	for _, q := range quotes[1:] {
+		if !q.CreatedAt.Before(latest.CreatedAt) {
+			latest = q
+		}
+	}
+	return latest, nil
+}
+
+// pickFirst returns the earliest created quote in quotes, the first added on a tie, or sql.ErrNoRows when there are
+// none
+func pickFirst(quotes []Quote) (Quote, error) {
+	if len(quotes) == 0 {
+		return Quote{}, sql.ErrNoRows
+	}
+	first := quotes[0]
+	for _, q := range quotes[1:] {
+		if q.CreatedAt.Before(first.CreatedAt) {
+			first = q
+		}
+	}
+	return first, nil
+}
+
+// withTag narrows keep to the quotes with the tag, unless it is empty
+func withTag(keep func(Quote) bool, tag string) func(Quote) bool {
+	return func(q Quote) bool { return keep(q) && q.hasTag(tag) }
+}
+
+// getRandQuote gets a random quote from the store, one with the tag unless it is empty
+func (m *memStore) getRandQuote(ctx context.Context, guild string, tag string) (Quote, error) {
+	quote, err := pickRandom(m.filter(withTag(byGuild(guild), tag)))
+	if err != nil {
+		return quote, fmt.Errorf("getRandQuote: %w", err)
+	}
+	return quote, nil
+}
+
+// getRandUserQuote gets a random quote from the store for a specific user, one with the tag unless it is empty
+func (m *memStore) getRandUserQuote(ctx context.Context, guild string, quotee string, tag string) (Quote, error) {
+	quote, err := pickRandom(m.filter(withTag(byQuotee(guild, quotee), tag)))
+	if err != nil {
+		return quote, fmt.Errorf("getRandUserQuote: %w", err)
+	}
+	return quote, nil
+}
+
+// getLatestQuote gets the most recently added quote from the store
+func (m *memStore) getLatestQuote(ctx context.Context, guild string) (Quote, error) {
+	quote, err := pickLatest(m.filter(byGuild(guild)))
+	if err != nil {
+		return quote, fmt.Errorf("getLatestQuote: %w", err)
+	}
+	return quote, nil
+}
+
+// getLatestUserQuote gets the most recently added quote from the store for a specific user
+func (m *memStore) getLatestUserQuote(ctx context.Context, guild string, quotee string) (Quote, error) {
+	quote, err := pickLatest(m.filter(byQuotee(guild, quotee)))
+	if err != nil {
+		return quote, fmt.Errorf("getLatestUserQuote: %w", err)
+	}
+	return quote, nil
+}
+
+// searchQuote returns up to searchLimit quotes matching s in the requested order, only those with the tag unless it
+// is empty. Relevance is the number of matching terms, as there is no full-text index to rank by.
+func (m *memStore) searchQuote(ctx context.Context, guild string, s string, order searchOrder, tag string) ([]Quote, error) {
+	q := parseSearchQuery(s)
+
+	type scored struct {
+		quote Quote
+		score int
+	}
+
+	// newest first, so ties keep insertion order
+	matches := m.filter(withTag(byGuild(guild), tag))
+	var results []scored
+	for x := len(matches) - 1; x >= 0; x-- {
+		if score := q.score(matches[x].Quote); score > 0 {
+			results = append(results, scored{quote: matches[x], score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if order == searchByRelevance {
+			return results[a].score > results[b].score
+		}
+		return results[a].quote.CreatedAt.After(results[b].quote.CreatedAt)
+	})
+
+	var quotes []Quote
+	for x := 0; x < len(results) && x < searchLimit; x++ {
+		quotes = append(quotes, results[x].quote)
+	}
+	return quotes, nil
+}
+
+// searchCount returns how many quotes match s, only counting those with the tag unless it is empty
+func (m *memStore) searchCount(ctx context.Context, guild string, s string, tag string) (int, error) {
+	q := parseSearchQuery(s)
+
+	var count int
+	for _, quote := range m.filter(withTag(byGuild(guild), tag)) {
+		if q.score(quote.Quote) > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// leaderboardCounts ranks everyone a leaderboard counts, most quotes first with ties in user order
+func (m *memStore) leaderboardCounts(guild string, lq leaderboardQuery) []leaderboardEntry {
+	counts := make(map[string]int)
+	for _, q := range m.filter(byGuild(guild)) {
+		if !lq.includes(q.CreatedAt) {
+			continue
+		}
+		if lq.Mode == rankQuoters {
+			counts[q.Quoter]++
+		} else {
+			counts[q.Quotee]++
+		}
+	}
+
+	leaderboard := make([]leaderboardEntry, 0, len(counts))
+	for user, count := range counts {
+		leaderboard = append(leaderboard, leaderboardEntry{User: user, Count: count})
+	}
+	sort.Slice(leaderboard, func(a, b int) bool {
+		if leaderboard[a].Count != leaderboard[b].Count {
+			return leaderboard[a].Count > leaderboard[b].Count
+		}
+		return leaderboard[a].User < leaderboard[b].User
+	})
+	return leaderboard
+}
+
+// getLeaderboard generates a leaderboard of the top 10 quotees or quoters
+func (m *memStore) getLeaderboard(ctx context.Context, guild string, lq leaderboardQuery) ([]leaderboardEntry, error) {
+	leaderboard := m.leaderboardCounts(guild, lq)
+	if len(leaderboard) > resultLimit {
+		leaderboard = leaderboard[:resultLimit]
+	}
+	return leaderboard, nil
+}
+
+// getLeaderboardRank finds a user's place on a leaderboard, or rank 0 if they have no quotes on it
+func (m *memStore) getLeaderboardRank(ctx context.Context, guild string, lq leaderboardQuery, user string) (leaderboardEntry, int, error) {
+	mention := fmt.Sprintf("<@%s>", user)
+	for x, entry := range m.leaderboardCounts(guild, lq) {
+		if entry.User == mention {
+			return entry, x + 1, nil
+		}
+	}
+	return leaderboardEntry{User: mention}, 0, nil
+}
+
+// getProfile sums up a user's quotes: their all-time ranks as quotee and quoter, their first and latest quote, the
+// month they were quoted most and who quotes them most
+func (m *memStore) getProfile(ctx context.Context, guild string, user string) (userProfile, error) {
+	var p userProfile
+	p.Quotee, p.QuoteeRank, _ = m.getLeaderboardRank(ctx, guild, leaderboardQuery{Mode: rankQuotees}, user)
+	p.Quoter, p.QuoterRank, _ = m.getLeaderboardRank(ctx, guild, leaderboardQuery{Mode: rankQuoters}, user)
+
+	quotes := m.filter(byQuotee(guild, user))
+	if len(quotes) == 0 {
+		return p, nil
+	}
+	p.First, _ = pickFirst(quotes)
+	p.Latest, _ = pickLatest(quotes)
+
+	months := make(map[time.Time]int)
+	quoters := make(map[string]int)
+	for _, q := range quotes {
+		months[statsMonth.start(q.CreatedAt)]++
+		if q.Quoter != q.Quotee {
+			quoters[q.Quoter]++
+		}
+	}
+
+	for month, count := range months {
+		if count > p.BusiestCount || (count == p.BusiestCount && month.After(p.BusiestMonth)) {
+			p.BusiestMonth, p.BusiestCount = month, count
+		}
+	}
+
+	for quoter, count := range quoters {
+		if count > p.TopQuoter.Count || (count == p.TopQuoter.Count && quoter < p.TopQuoter.User) {
+			p.TopQuoter = leaderboardEntry{User: quoter, Count: count}
+		}
+	}
+	return p, nil
+}
+
+// getActivity counts the quotes created in each UTC week or month, oldest first, skipping those without any. An
+// empty quotee counts every quote in the guild.
+func (m *memStore) getActivity(ctx context.Context, guild string, quotee string, iv statsInterval) ([]activityCount, error) {
+	keep := byGuild(guild)
+	if quotee != "" {
+		keep = byQuotee(guild, quotee)
+	}
+
+	counts := make(map[time.Time]int)
+	for _, q := range m.filter(keep) {
+		counts[iv.start(q.CreatedAt)]++
+	}
+	activity := make([]activityCount, 0, len(counts))
+	for start, count := range counts {
+		activity = append(activity, activityCount{Start: start, Count: count})
+	}
+	sort.Slice(activity, func(a, b int) bool { return activity[a].Start.Before(activity[b].Start) })
+	return activity, nil
+}
+
+// quoteCount gets the number of quotes in a guild, or in every guild when guild is empty. It is always exact, so
+// there is nothing to cache.
+func (m *memStore) quoteCount(ctx context.Context, guild string) (int, error) {
+	return len(m.filter(func(q Quote) bool { return guild == "" || q.GuildID == guild })), nil
+}
+
+// listQuotes gets every quote in a guild, oldest first. An empty guild lists the quotes of every guild.
+func (m *memStore) listQuotes(ctx context.Context, guild string) ([]Quote, error) {
+	return m.filter(func(q Quote) bool { return guild == "" || q.GuildID == guild }), nil
+}
+
+// getDailyQuote gets the quote of the day for a guild, picking and recording one on the first call for a day. No
+// quote repeats until every quote in the guild has been picked.
+func (m *memStore) getDailyQuote(ctx context.Context, guild string, day time.Time) (Quote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.daily == nil {
+		m.daily = make(map[string]map[string]dailyPick)
+	}
+	picks := m.daily[guild]
+	if picks == nil {
+		picks = make(map[string]dailyPick)
+		m.daily[guild] = picks
+	}
+
+	key := dailyKey(day)
+	if pick, ok := picks[key]; ok {
+		if x := m.find(guild, pick.id); x >= 0 {
+			return m.quotes[x], nil
+		}
+		// the quote has since been deleted, so pick again
+		delete(picks, key)
+	}
+
+	cycle := 0
+	for _, pick := range picks {
+		cycle = max(cycle, pick.cycle)
+	}
+	picked := make(map[int64]bool)
+	for _, pick := range picks {
+		if pick.cycle == cycle {
+			picked[pick.id] = true
+		}
+	}
+
+	var all, remaining []Quote
+	for _, q := range m.quotes {
+		if q.GuildID != guild {
+			continue
+		}
+		all = append(all, q)
+		if !picked[q.ID] {
+			remaining = append(remaining, q)
+		}
+	}
+	if len(remaining) == 0 {
+		cycle++
+		remaining = all
+	}
+	if len(remaining) == 0 {
+		return Quote{}, fmt.Errorf("getDailyQuote: %w", sql.ErrNoRows)
+	}
+
+	quote := remaining[dailySeed(guild, key, cycle)%uint64(len(remaining))]
+	picks[key] = dailyPick{cycle: cycle, id: quote.ID}
+	return quote, nil
+}
+
+// Close is a no-op as there is nothing to release
+func (m *memStore) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	commandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiltbot_commands_total",
+		Help: "Commands and components handled, by command.",
+	}, []string{"command"})
+
+	commandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiltbot_command_errors_total",
+		Help: "Commands and components that replied with an error, by command.",
+	}, []string{"command"})
+
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tiltbot_command_duration_seconds",
+		Help:    "Time taken to handle a command or component, by command.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"})
+
+	dbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tiltbot_db_query_duration_seconds",
+		Help:    "Time taken by each database method.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method"})
+
+	cacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "tiltbot_quote_cache_lookups_total",
+		Help: "Quote count cache lookups, by result.",
+	}, []string{"result"})
+)
+
+// commandName labels an interaction in metrics: the subcommand for /quote, the command name for other commands and
+// the custom ID prefix for components
+func commandName(i *discordgo.InteractionCreate) string {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		if len(data.Options) > 0 && data.Options[0].Type == discordgo.ApplicationCommandOptionSubCommand {
+			return data.Name + " " + data.Options[0].Name
+		}
+		return data.Name
+	case discordgo.InteractionMessageComponent:
+		prefix, _, _ := strings.Cut(i.MessageComponentData().CustomID, ":")
+		return prefix
+	default:
+		return i.Type.String()
+	}
+}
+
+// observeCommand counts an interaction and returns a function that records how long it took to handle
+func observeCommand(i *discordgo.InteractionCreate) func() {
+	name := commandName(i)
+	commandsTotal.WithLabelValues(name).Inc()
+	start := time.Now()
+	return func() {
+		commandDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeQuery returns a function that records how long the database method took. Use it as
+// defer observeQuery("name")().
+func observeQuery(method string) func() {
+	start := time.Now()
+	return func() {
+		dbDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// registerQuoteGauge exports the number of quotes across every guild, counted when Prometheus scrapes
+func registerQuoteGauge(db QuoteStore) error {
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "tiltbot_quotes",
+		Help: "Quotes in the collection across every guild.",
+	}, func() float64 {
+		ctx, cancel := ctxWithTimeout()
+		defer cancel()
+
+		count, err := db.quoteCount(ctx, "")
+		if err != nil {
+			slog.Error("error counting quotes for metrics", "err", err)
+			return 0
+		}
+		return float64(count)
+	})
+
+	return prometheus.Register(gauge)
+}
+
+// startMetrics serves /metrics on METRICS_ADDR. It returns a nil server when METRICS_ADDR is not set.
+func startMetrics(db QuoteStore) (*http.Server, error) {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+	if err := registerQuoteGauge(db); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		slog.Info("serving metrics", "addr", addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "err", err)
+		}
+	}()
+	return srv, nil
+}
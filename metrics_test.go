@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// commandInteraction builds an application command interaction, with a subcommand when sub is not empty
+func commandInteraction(name string, sub string) *discordgo.InteractionCreate {
+	data := discordgo.ApplicationCommandInteractionData{Name: name}
+	if sub != "" {
+		data.Options = []*discordgo.ApplicationCommandInteractionDataOption{
+			{Name: sub, Type: discordgo.ApplicationCommandOptionSubCommand},
+		}
+	}
+	return &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionApplicationCommand,
+		Data: data,
+	}}
+}
+
+func TestCommandName(t *testing.T) {
+	button := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Type: discordgo.InteractionMessageComponent,
+		Data: discordgo.MessageComponentInteractionData{CustomID: searchButtonID("123", 2)},
+	}}
+
+	tests := []struct {
+		name string
+		i    *discordgo.InteractionCreate
+		want string
+	}{
+		{"subcommand", commandInteraction("quote", "add"), "quote add"},
+		{"message command", commandInteraction(saveQuoteCommand, ""), saveQuoteCommand},
+		{"component", button, searchComponentID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandName(tt.i); got != tt.want {
+				t.Errorf("commandName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveCommand(t *testing.T) {
+	i := commandInteraction("quote", "observed")
+	before := testutil.ToFloat64(commandsTotal.WithLabelValues("quote observed"))
+
+	observeCommand(i)()
+
+	if got := testutil.ToFloat64(commandsTotal.WithLabelValues("quote observed")); got != before+1 {
+		t.Errorf("commands counted = %v, want %v", got, before+1)
+	}
+	if n := testutil.CollectAndCount(commandDuration, "tiltbot_command_duration_seconds"); n == 0 {
+		t.Error("expected a command duration series")
+	}
+}
+
+func TestDBAndCacheMetrics(t *testing.T) {
+	db := newTestDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hits := testutil.ToFloat64(cacheLookups.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(cacheLookups.WithLabelValues("miss"))
+
+	for x := 0; x < 2; x++ {
+		if _, err := db.quoteCount(ctx, testGuild); err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(cacheLookups.WithLabelValues("miss")); got != misses+1 {
+		t.Errorf("cache misses = %v, want %v", got, misses+1)
+	}
+	if got := testutil.ToFloat64(cacheLookups.WithLabelValues("hit")); got != hits+1 {
+		t.Errorf("cache hits = %v, want %v", got, hits+1)
+	}
+	if n := testutil.CollectAndCount(dbDuration, "tiltbot_db_query_duration_seconds"); n == 0 {
+		t.Error("expected a database duration series")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// handlerFunc handles one interaction
+type handlerFunc func(c *HandlerContext, i *discordgo.InteractionCreate)
+
+// middleware wraps a handler with behaviour shared by every interaction
+type middleware func(next handlerFunc) handlerFunc
+
+// chain wraps h in every middleware, the first outermost
+func chain(h handlerFunc, mw ...middleware) handlerFunc {
+	for x := len(mw) - 1; x >= 0; x-- {
+		h = mw[x](h)
+	}
+	return h
+}
+
+// interactionMiddleware runs around every command and component handler. Replies are tracked outside panic recovery so
+// a recovered handler can still answer, and permission checks run innermost so refusals are timed, logged and rate
+// limited like any other reply.
+var interactionMiddleware = []middleware{
+	timed,
+	logged,
+	deferSlow(deferAfter),
+	recoverPanics,
+	rateLimited,
+	requireGuild,
+	requireOwner(ownerCommands),
+}
+
+// autocompleteMiddleware runs around every autocomplete handler. Suggestions are requested as the user types, so
+// they are neither logged nor rate limited, and they have no reply to defer.
+var autocompleteMiddleware = []middleware{
+	timed,
+	recoverPanics,
+}
+
+// ownerCommands are the commands only the bot owner may run, with what they do for the message refusing anyone else
+var ownerCommands = map[string]string{
+	"quote export": "export the collection",
+	"quote import": "import quotes",
+}
+
+// timed records the count and duration of every interaction in the metrics
+func timed(next handlerFunc) handlerFunc {
+	return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		defer observeCommand(i)()
+		next(c, i)
+	}
+}
+
+// logged logs every interaction once it has been handled
+func logged(next handlerFunc) handlerFunc {
+	return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		start := time.Now()
+		next(c, i)
+		slog.InfoContext(withInteraction(context.Background(), i), "handled interaction", "duration", time.Since(start))
+	}
+}
+
+// deferSlow defers the reply of handlers that have not replied after the given delay
+func deferSlow(after time.Duration) middleware {
+	return func(next handlerFunc) handlerFunc {
+		return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+			defer trackReply(c.Discord, i, after)()
+			next(c, i)
+		}
+	}
+}
+
+// recoverPanics turns a panicking handler into an error reply and alerts the bot owner, instead of crashing the bot
+func recoverPanics(next handlerFunc) handlerFunc {
+	return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			ctx := withInteraction(context.Background(), i)
+			slog.ErrorContext(ctx, "handler panicked", "panic", p, "stack", string(debug.Stack()))
+			sendErr(c.Discord, i, fmt.Errorf("internal error"))
+
+			if c.AlertOwner != nil {
+				msg := fmt.Sprintf("`%s` panicked: %v\nReference: %s", commandName(i), p, correlationID(i))
+				if err := c.AlertOwner(ctx, msg); err != nil {
+					slog.ErrorContext(ctx, "error alerting the owner", "err", err)
+				}
+			}
+		}()
+		next(c, i)
+	}
+}
+
+// rateLimited refuses commands from users who exceed c.Limiter. Components are not limited, since paging through
+// results never queries the database.
+func rateLimited(next handlerFunc) handlerFunc {
+	return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		if c.Limiter != nil && i.Type == discordgo.InteractionApplicationCommand {
+			if wait := c.Limiter.reserve(interactionUser(i), time.Now()); wait > 0 {
+				sendEphemeral(c.Discord, i, fmt.Sprintf("You're sending commands too quickly, try again in %s", wait.Round(time.Second)))
+				return
+			}
+		}
+		next(c, i)
+	}
+}
+
+// requireGuild answers commands sent in a DM instead of running them, since every collection belongs to a guild
+func requireGuild(next handlerFunc) handlerFunc {
+	return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		if i.GuildID == "" {
+			sendMsg(c.Discord, i, "Quotes are only available inside a server")
+			return
+		}
+		next(c, i)
+	}
+}
+
+// requireOwner refuses the commands in owned, keyed by commandName, to anyone but the bot owner
+func requireOwner(owned map[string]string) middleware {
+	return func(next handlerFunc) handlerFunc {
+		return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+			if action, ok := owned[commandName(i)]; ok && !isOwner(interactionUser(i)) {
+				sendEphemeral(c.Discord, i, fmt.Sprintf("Only <@%s> can %s", os.Getenv("DISC_BOT_OWNER_ID"), action))
+				return
+			}
+			next(c, i)
+		}
+	}
+}
+
+// rateLimiter gives every user a bucket of burst commands that refills one command per interval
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	users    map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+const (
+	rateBurst    = 5
+	rateInterval = 3 * time.Second
+	// rateUsersKept is how many users the limiter tracks before forgetting those whose bucket has refilled
+	rateUsersKept = 1024
+)
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{interval: interval, burst: burst, users: make(map[string]*rateBucket)}
+}
+
+// reserve takes a command from the user's bucket. It returns zero if the user may run the command, and otherwise how
+// long until they may.
+func (l *rateLimiter) reserve(user string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.users[user]
+	if !ok {
+		if len(l.users) >= rateUsersKept {
+			l.forgetIdle(now)
+		}
+		b = &rateBucket{tokens: float64(l.burst), last: now}
+		l.users[user] = b
+	}
+
+	b.tokens = min(float64(l.burst), b.tokens+float64(now.Sub(b.last))/float64(l.interval))
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	return 0
+}
+
+// forgetIdle drops the buckets that have refilled, which behave the same as a new one
+func (l *rateLimiter) forgetIdle(now time.Time) {
+	for user, b := range l.users {
+		if b.tokens+float64(now.Sub(b.last))/float64(l.interval) >= float64(l.burst) {
+			delete(l.users, user)
+		}
+	}
+}
+
+// ownerDM returns an alert function that sends the bot owner a direct message
+func ownerDM(s *discordgo.Session) func(ctx context.Context, msg string) error {
+	return func(ctx context.Context, msg string) error {
+		ch, err := s.UserChannelCreate(os.Getenv("DISC_BOT_OWNER_ID"), discordgo.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("ownerDM: %w", err)
+		}
+		if _, err := s.ChannelMessageSend(ch.ID, msg, discordgo.WithContext(ctx)); err != nil {
+			return fmt.Errorf("ownerDM: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// runMiddleware runs h wrapped in mw for an interaction and returns what it replied
+func runMiddleware(t *testing.T, c *HandlerContext, i *discordgo.InteractionCreate, h handlerFunc, mw ...middleware) []fakeCall {
+	t.Helper()
+	if c.Discord == nil {
+		c.Discord = &fakeResponder{}
+	}
+	chain(h, mw...)(c, i)
+	f := c.Discord.(*fakeResponder)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// replyHandler answers with a fixed message, so tests can tell whether it ran
+func replyHandler(c *HandlerContext, i *discordgo.InteractionCreate) {
+	sendMsg(c.Discord, i, "handled")
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) middleware {
+		return func(next handlerFunc) handlerFunc {
+			return func(c *HandlerContext, i *discordgo.InteractionCreate) {
+				order = append(order, name+" before")
+				next(c, i)
+				order = append(order, name+" after")
+			}
+		}
+	}
+
+	chain(func(c *HandlerContext, i *discordgo.InteractionCreate) { order = append(order, "handler") },
+		mark("outer"), mark("inner"))(&HandlerContext{}, quoteInteraction(testUser, "count"))
+
+	want := "outer before,inner before,handler,inner after,outer after"
+	if got := strings.Join(order, ","); got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	var alerts []string
+	c := &HandlerContext{AlertOwner: func(ctx context.Context, msg string) error {
+		alerts = append(alerts, msg)
+		return nil
+	}}
+	i := quoteInteraction(testUser, "add")
+	i.Member = nil
+
+	calls := runMiddleware(t, c, i, func(c *HandlerContext, i *discordgo.InteractionCreate) {
+		_ = i.Member.User.ID // the nil dereference a DM used to cause
+	}, recoverPanics)
+
+	if len(calls) != 1 || !strings.Contains(calls[0].Data.Content, "Error message: internal error") {
+		t.Fatalf("calls = %+v, want an error reply", calls)
+	}
+	if len(alerts) != 1 || !strings.HasPrefix(alerts[0], "`quote add` panicked: runtime error: invalid memory address") ||
+		!strings.Contains(alerts[0], "Reference: "+i.ID) {
+		t.Errorf("alerts = %q", alerts)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(2, time.Second)
+	now := time.Now()
+
+	if l.reserve("a", now) != 0 || l.reserve("a", now) != 0 {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if wait := l.reserve("a", now); wait != time.Second {
+		t.Errorf("wait = %v, want 1s", wait)
+	}
+	if l.reserve("b", now) != 0 {
+		t.Error("expected users to have separate buckets")
+	}
+	if l.reserve("a", now.Add(time.Second)) != 0 {
+		t.Error("expected a command to be allowed once the bucket refills")
+	}
+
+	l.forgetIdle(now.Add(time.Hour))
+	if len(l.users) != 0 {
+		t.Errorf("%d users kept after their buckets refilled", len(l.users))
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	c := &HandlerContext{Limiter: newRateLimiter(1, time.Minute)}
+
+	runMiddleware(t, c, quoteInteraction(testUser, "count"), replyHandler, rateLimited)
+	calls := runMiddleware(t, c, quoteInteraction(testUser, "count"), replyHandler, rateLimited)
+	if got := calls[1].Data; got.Content != "You're sending commands too quickly, try again in 1m0s" ||
+		got.Flags&discordgo.MessageFlagsEphemeral == 0 {
+		t.Errorf("second command replied %+v", got)
+	}
+
+	// components only page through cached results, so they are never limited
+	button := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:     "1",
+		Type:   discordgo.InteractionMessageComponent,
+		Member: &discordgo.Member{User: &discordgo.User{ID: testUser}},
+		Data:   discordgo.MessageComponentInteractionData{CustomID: searchButtonID("1", 1)},
+	}}
+	if calls = runMiddleware(t, c, button, replyHandler, rateLimited); calls[2].Data.Content != "handled" {
+		t.Errorf("component replied %q", calls[2].Data.Content)
+	}
+}
+
+func TestRequireGuild(t *testing.T) {
+	dm := quoteInteraction(testUser, "count")
+	dm.GuildID = ""
+	if calls := runMiddleware(t, &HandlerContext{}, dm, replyHandler, requireGuild); calls[0].Data.Content != "Quotes are only available inside a server" {
+		t.Errorf("DM replied %q", calls[0].Data.Content)
+	}
+	if calls := runMiddleware(t, &HandlerContext{}, quoteInteraction(testUser, "count"), replyHandler, requireGuild); calls[0].Data.Content != "handled" {
+		t.Errorf("guild command replied %q", calls[0].Data.Content)
+	}
+}
+
+func TestRequireOwner(t *testing.T) {
+	t.Setenv("DISC_BOT_OWNER_ID", testOwner)
+	owned := requireOwner(map[string]string{"quote export": "export the collection"})
+
+	tests := []struct {
+		user, sub, want string
+	}{
+		{testOwner, "export", "handled"},
+		{testUser, "export", "Only <@" + testOwner + "> can export the collection"},
+		{testUser, "count", "handled"},
+	}
+	for _, tt := range tests {
+		calls := runMiddleware(t, &HandlerContext{}, quoteInteraction(tt.user, tt.sub), replyHandler, owned)
+		if calls[0].Data.Content != tt.want {
+			t.Errorf("%s by %s replied %q, want %q", tt.sub, tt.user, calls[0].Data.Content, tt.want)
+		}
+	}
+}
+
+func TestTimedAndLogged(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)}))
+
+	i := quoteInteraction(testUser, "timed")
+	before := testutil.ToFloat64(commandsTotal.WithLabelValues("quote timed"))
+	runMiddleware(t, &HandlerContext{}, i, replyHandler, timed, logged)
+
+	if got := testutil.ToFloat64(commandsTotal.WithLabelValues("quote timed")); got != before+1 {
+		t.Errorf("commands counted = %v, want %v", got, before+1)
+	}
+	line := decodeLogLine(t, &buf)
+	if line["msg"] != "handled interaction" || line["command"] != "quote timed" || line["duration"] == nil {
+		t.Errorf("log line = %v", line)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// migrationsTable returns the metadata table that records which schema versions have been applied to table.
+// Keying it by table lets several quote tables share one database without sharing a migration history.
+func migrationsTable(table string) string {
+	return table + "_migrations"
+}
+
+// migrationEnv holds the runtime values a migration needs to build its statements
+type migrationEnv struct {
+	Table string
+	// LegacyGuild is the guild that owned the collection before quotes were scoped per guild
+	LegacyGuild string
+}
+
+// migration is a single versioned change to the database schema
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, tx *sql.Tx, env migrationEnv) error
+}
+
+// sqliteMigrations is the ordered list of schema changes for SQLite. New schema changes are appended here and
+// must never modify an existing entry once it has shipped.
+var sqliteMigrations = []migration{
+	{
+		version:     1,
+		description: "create quotes table",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			// IF NOT EXISTS lets databases that were created by hand adopt the migration history in place
+			return execAll(ctx, tx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				id        INTEGER PRIMARY KEY AUTOINCREMENT,
+				quote     TEXT    NOT NULL,
+				quotee    TEXT    NOT NULL,
+				quoter    TEXT    NOT NULL,
+				createdAt TIMESTAMP NOT NULL
+			)`, env.Table))
+		},
+	},
+	{
+		version:     2,
+		description: "scope quotes to a guild",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addGuildColumn(ctx, tx, env)
+		},
+	},
+	{
+		version:     3,
+		description: "add full-text search index",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			// an external content FTS5 table stores only the index; the triggers keep it in sync with the quotes table
+			fts := env.Table + "_fts"
+			return execAll(ctx, tx,
+				fmt.Sprintf(`CREATE VIRTUAL TABLE %s USING fts5(quote, content='%s', content_rowid='id', tokenize='porter unicode61')`, fts, env.Table),
+				fmt.Sprintf(`CREATE TRIGGER %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+					INSERT INTO %[1]s (rowid, quote) VALUES (new.id, new.quote);
+				END`, fts, env.Table),
+				fmt.Sprintf(`CREATE TRIGGER %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+					INSERT INTO %[1]s (%[1]s, rowid, quote) VALUES ('delete', old.id, old.quote);
+				END`, fts, env.Table),
+				fmt.Sprintf(`CREATE TRIGGER %[1]s_au AFTER UPDATE ON %[2]s BEGIN
+					INSERT INTO %[1]s (%[1]s, rowid, quote) VALUES ('delete', old.id, old.quote);
+					INSERT INTO %[1]s (rowid, quote) VALUES (new.id, new.quote);
+				END`, fts, env.Table),
+				// index any quotes that already exist
+				fmt.Sprintf(`INSERT INTO %[1]s (%[1]s) VALUES ('rebuild')`, fts),
+			)
+		},
+	},
+	{
+		version:     4,
+		description: "record the source message of a quote",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addSourceColumns(ctx, tx, env)
+		},
+	},
+	{
+		version:     5,
+		description: "record quote of the day picks",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addDailyTable(ctx, tx, env)
+		},
+	},
+	{
+		version:     6,
+		description: "tag quotes",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addTagTables(ctx, tx, env, "INTEGER PRIMARY KEY AUTOINCREMENT")
+		},
+	},
+}
+
+// addGuildColumn adds the guild column and assigns every existing quote to the legacy guild. The statements are
+// the same in SQLite and PostgreSQL.
+func addGuildColumn(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+	var existing int
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, env.Table)).Scan(&existing); err != nil {
+		return err
+	}
+	if existing > 0 && env.LegacyGuild == "" {
+		return fmt.Errorf("DISCORD_GUILD must be set to assign %d existing quotes to a guild", existing)
+	}
+
+	return execAll(ctx, tx,
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN guild TEXT NOT NULL DEFAULT ''`, env.Table),
+		fmt.Sprintf(`UPDATE %s SET guild = %s`, env.Table, sqlString(env.LegacyGuild)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_guild_quotee ON %s (guild, quotee)`, env.Table, env.Table),
+	)
+}
+
+// addSourceColumns adds the channel and message a quote was saved from. Quotes added by hand leave them empty.
+func addSourceColumns(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+	return execAll(ctx, tx,
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN channelID TEXT NOT NULL DEFAULT ''`, env.Table),
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN messageID TEXT NOT NULL DEFAULT ''`, env.Table),
+	)
+}
+
+// addDailyTable creates the table of quote of the day picks. A cycle ends once every quote in the guild has been
+// picked, so no quote repeats until the collection is exhausted.
+func addDailyTable(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+	return execAll(ctx, tx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		guild   TEXT    NOT NULL,
+		day     TEXT    NOT NULL,
+		cycle   INTEGER NOT NULL,
+		quoteID BIGINT  NOT NULL,
+		PRIMARY KEY (guild, day)
+	)`, dailyTable(env.Table)))
+}
+
+// dailyTable returns the table that records the quote of the day picks for table
+func dailyTable(table string) string {
+	return table + "_daily"
+}
+
+// addTagTables creates the tags of each guild and the table linking quotes to them. id is the type of an
+// auto-incrementing primary key in the dialect.
+func addTagTables(ctx context.Context, tx *sql.Tx, env migrationEnv, id string) error {
+	return execAll(ctx, tx,
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id    %s,
+			guild TEXT NOT NULL,
+			name  TEXT NOT NULL,
+			UNIQUE (guild, name)
+		)`, tagsTable(env.Table), id),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			quoteID BIGINT NOT NULL,
+			tagID   BIGINT NOT NULL,
+			PRIMARY KEY (quoteID, tagID)
+		)`, quoteTagsTable(env.Table)),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_tag ON %[1]s (tagID)`, quoteTagsTable(env.Table)),
+	)
+}
+
+// tagsTable returns the table of tag names for table
+func tagsTable(table string) string {
+	return table + "_tags"
+}
+
+// quoteTagsTable returns the table linking the quotes in table to their tags
+func quoteTagsTable(table string) string {
+	return table + "_quote_tags"
+}
+
+// execAll executes each statement in order inside the transaction
+func execAll(ctx context.Context, tx *sql.Tx, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate applies every migration that has not yet been recorded in the metadata table. Each migration runs in
+// its own transaction so a failure leaves the database at the last successfully applied version.
+func migrate(ctx context.Context, conn *sql.DB, env migrationEnv, migrations []migration) error {
+	metaTable := migrationsTable(env.Table)
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version     INTEGER PRIMARY KEY,
+		description TEXT      NOT NULL,
+		appliedAt   TIMESTAMP NOT NULL
+	)`, metaTable)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error creating %s: %w", metaTable, err)
+	}
+
+	applied, err := appliedVersions(ctx, conn, metaTable)
+	if err != nil {
+		return err
+	}
+
+	pending := make([]migration, 0, len(migrations))
+	for _, m := range migrations {
+		if !applied[m.version] {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(a, b int) bool { return pending[a].version < pending[b].version })
+
+	for _, m := range pending {
+		if err := applyMigration(ctx, conn, env, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+		slog.InfoContext(ctx, "applied migration", "version", m.version, "description", m.description)
+	}
+
+	return nil
+}
+
+// appliedVersions returns the set of migration versions already recorded in the metadata table
+func appliedVersions(ctx context.Context, conn *sql.DB, metaTable string) (map[int]bool, error) {
+	applied := make(map[int]bool)
+
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(`SELECT version FROM %s`, metaTable))
+	if err != nil {
+		return applied, fmt.Errorf("error reading applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return applied, fmt.Errorf("error scanning migration version: %w", err)
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// applyMigration runs a single migration and records its version in one transaction
+func applyMigration(ctx context.Context, conn *sql.DB, env migrationEnv, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(ctx, tx, env); err != nil {
+		return err
+	}
+
+	// values are inlined rather than bound so the statement is valid in every dialect
+	query := fmt.Sprintf(`INSERT INTO %s (version, description, appliedAt) VALUES (%d, %s, CURRENT_TIMESTAMP)`,
+		migrationsTable(env.Table), m.version, sqlString(m.description))
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest applied migration version, or 0 for a database that has never been migrated
+func schemaVersion(ctx context.Context, conn *sql.DB, table string) (int, error) {
+	var version sql.NullInt64
+	query := fmt.Sprintf(`SELECT MAX(version) FROM %s`, migrationsTable(table))
+	if err := conn.QueryRowContext(ctx, query).Scan(&version); err != nil {
+		return 0, fmt.Errorf("schemaVersion: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func openMemDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open in-memory db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := openMemDB(t)
+	ctx := context.Background()
+	env := migrationEnv{Table: "quotes"}
+
+	if err := migrate(ctx, db, env, sqliteMigrations); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	version, err := schemaVersion(ctx, db, "quotes")
+	if err != nil {
+		t.Fatalf("schemaVersion: %v", err)
+	}
+	want := sqliteMigrations[len(sqliteMigrations)-1].version
+	if version != want {
+		t.Errorf("schema version = %d, want %d", version, want)
+	}
+
+	_, err = db.Exec(`INSERT INTO quotes (quote, quotee, quoter, createdAt, guild) VALUES (?, ?, ?, ?, ?)`,
+		"hello", "<@1>", "<@2>", time.Now(), "100")
+	if err != nil {
+		t.Fatalf("insert into migrated table: %v", err)
+	}
+
+	// running again must be a no-op
+	if err := migrate(ctx, db, env, sqliteMigrations); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateExistingDatabase(t *testing.T) {
+	db := openMemDB(t)
+	ctx := context.Background()
+
+	// a database created by hand before migrations existed
+	_, err := db.Exec(`CREATE TABLE quotes (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		quote     TEXT    NOT NULL,
+		quotee    TEXT    NOT NULL,
+		quoter    TEXT    NOT NULL,
+		createdAt TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO quotes (quote, quotee, quoter, createdAt) VALUES (?, ?, ?, ?)`,
+		"legacy", "<@1>", "<@2>", time.Now())
+	if err != nil {
+		t.Fatalf("insert legacy row: %v", err)
+	}
+
+	// existing quotes cannot be assigned without knowing which guild they came from
+	if err := migrate(ctx, db, migrationEnv{Table: "quotes"}, sqliteMigrations); err == nil {
+		t.Fatal("expected error migrating legacy rows without a guild, got nil")
+	}
+
+	if err := migrate(ctx, db, migrationEnv{Table: "quotes", LegacyGuild: "100"}, sqliteMigrations); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM quotes WHERE guild = '100'`).Scan(&count); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected legacy row to be assigned to the legacy guild, got %d rows", count)
+	}
+}
+
+func TestMigrateRollsBackFailedMigration(t *testing.T) {
+	db := openMemDB(t)
+	ctx := context.Background()
+
+	migrations := []migration{
+		sqliteMigrations[0],
+		{
+			version:     2,
+			description: "broken",
+			up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+				if err := execAll(ctx, tx, `CREATE TABLE half_done (id INTEGER)`); err != nil {
+					return err
+				}
+				return errors.New("boom")
+			},
+		},
+	}
+
+	if err := migrate(ctx, db, migrationEnv{Table: "quotes"}, migrations); err == nil {
+		t.Fatal("expected error from broken migration, got nil")
+	}
+
+	version, err := schemaVersion(ctx, db, "quotes")
+	if err != nil {
+		t.Fatalf("schemaVersion: %v", err)
+	}
+	if version != 1 {
+		t.Errorf("schema version = %d, want 1", version)
+	}
+
+	var name string
+	err = db.QueryRow(`SELECT name FROM sqlite_master WHERE name = 'half_done'`).Scan(&name)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected half_done table to be rolled back, got %q (%v)", name, err)
+	}
+}
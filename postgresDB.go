@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresMigrations is the ordered list of schema changes for PostgreSQL. It mirrors sqliteMigrations version
+// for version so both backends always share the same logical schema.
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "create quotes table",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return execAll(ctx, tx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+				id        BIGSERIAL   PRIMARY KEY,
+				quote     TEXT        NOT NULL,
+				quotee    TEXT        NOT NULL,
+				quoter    TEXT        NOT NULL,
+				createdAt TIMESTAMPTZ NOT NULL
+			)`, env.Table))
+		},
+	},
+	{
+		version:     2,
+		description: "scope quotes to a guild",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addGuildColumn(ctx, tx, env)
+		},
+	},
+	{
+		version:     3,
+		description: "add full-text search index",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			// the expression must match pgSearchVector exactly for the planner to use the index
+			return execAll(ctx, tx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_fts ON %s USING GIN (%s)`,
+				env.Table, env.Table, pgSearchVector))
+		},
+	},
+	{
+		version:     4,
+		description: "record the source message of a quote",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addSourceColumns(ctx, tx, env)
+		},
+	},
+	{
+		version:     5,
+		description: "record quote of the day picks",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addDailyTable(ctx, tx, env)
+		},
+	},
+	{
+		version:     6,
+		description: "tag quotes",
+		up: func(ctx context.Context, tx *sql.Tx, env migrationEnv) error {
+			return addTagTables(ctx, tx, env, "BIGSERIAL PRIMARY KEY")
+		},
+	},
+}
+
+// pgSearchVector is the tsvector expression quotes are indexed and searched by
+const pgSearchVector = "to_tsvector('english', quote)"
+
+// newPGConn creates a new connection to the PostgreSQL database
+func newPGConn() (*SQLConn, error) {
+	return openSQLConn(dialectPostgres, os.Getenv("POSTGRES_DSN"), envMigrationEnv("POSTGRES_TABLE_NAME"))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// profileQuoteLength is the most characters of a quote a profile shows
+const profileQuoteLength = 200
+
+// userProfile sums up one user's part in a guild's collection. Quotee and Quoter hold their all-time counts as each,
+// with their rank on that leaderboard or 0 if they are not on it. The remaining fields describe the quotes the user
+// spoke and are left zero if they have never been quoted.
+type userProfile struct {
+	Quotee, Quoter         leaderboardEntry
+	QuoteeRank, QuoterRank int
+	First, Latest          Quote
+	// BusiestMonth is the first day of the UTC month the user was quoted most in, the latest on a tie
+	BusiestMonth time.Time
+	BusiestCount int
+	// TopQuoter is whoever else added the most of the user's quotes, empty if they only quote themselves
+	TopQuoter leaderboardEntry
+}
+
+// profileEmbed renders the profile of the user with the given ID
+func profileEmbed(user string, p userProfile) *discordgo.MessageEmbed {
+	fields := []*discordgo.MessageEmbedField{
+		{Name: "Quoted", Value: profileCount(p.Quotee.Count, p.QuoteeRank), Inline: true},
+		{Name: "Quotes Added", Value: profileCount(p.Quoter.Count, p.QuoterRank), Inline: true},
+	}
+	if p.Quotee.Count > 0 {
+		fields = append(fields,
+			&discordgo.MessageEmbedField{Name: "First Quote", Value: profileQuote(p.First)},
+			&discordgo.MessageEmbedField{Name: "Latest Quote", Value: profileQuote(p.Latest)},
+			&discordgo.MessageEmbedField{Name: "Busiest Month", Value: fmt.Sprintf("%s with %s", p.BusiestMonth.Format("January 2006"), plural(p.BusiestCount, "quote"))},
+		)
+	}
+	if p.TopQuoter.User != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Quoted Most By",
+			Value: fmt.Sprintf("%s with %s", p.TopQuoter.User, plural(p.TopQuoter.Count, "quote")),
+		})
+	}
+
+	e := generateEmbed("Quote Profile", fields)
+	e.Description = fmt.Sprintf("<@%s>", user)
+	return e
+}
+
+// profileCount renders a count and the leaderboard rank it earns
+func profileCount(count, rank int) string {
+	if rank == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (rank #%d)", count, rank)
+}
+
+// profileQuote renders a quote on one line with its number and date, shortening long quotes
+func profileQuote(q Quote) string {
+	text := []rune(q.Quote)
+	if len(text) > profileQuoteLength {
+		text = append(text[:profileQuoteLength-1], '…')
+	}
+	return fmt.Sprintf("#%d on %s: %s", q.ID, q.CreatedAt.Local().Format("Jan 2, 2006"), string(text))
+}
+
+// plural renders a count of things, adding an s unless there is one
+func plural(n int, thing string) string {
+	if n == 1 {
+		return "1 " + thing
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestProfileQuote(t *testing.T) {
+	q := Quote{ID: 4, Quote: strings.Repeat("é", profileQuoteLength+1), CreatedAt: time.Date(2024, time.March, 5, 12, 0, 0, 0, time.Local)}
+	got := profileQuote(q)
+	if !strings.HasPrefix(got, "#4 on Mar 5, 2024: éé") || !strings.HasSuffix(got, "é…") {
+		t.Errorf("profileQuote = %q", got)
+	}
+	if text := got[strings.Index(got, ": ")+2:]; utf8.RuneCountInString(text) != profileQuoteLength {
+		t.Errorf("shortened to %d characters, want %d", utf8.RuneCountInString(text), profileQuoteLength)
+	}
+
+	q.Quote = "short"
+	if got := profileQuote(q); got != "#4 on Mar 5, 2024: short" {
+		t.Errorf("profileQuote = %q", got)
+	}
+}
+
+func TestProfileCount(t *testing.T) {
+	if got := profileCount(0, 0); got != "0" {
+		t.Errorf("unranked = %q", got)
+	}
+	if got := profileCount(12, 3); got != "12 (rank #3)" {
+		t.Errorf("ranked = %q", got)
+	}
+}
@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"sync"
@@ -17,78 +18,393 @@ import (
 
 // Quote is a contruct to hold the shape of quotes in the DB
 type Quote struct {
+	ID        int64
 	CreatedAt time.Time
 	Quote     string
 	Quotee    string
 	Quoter    string
+	GuildID   string
+	ChannelID string
+	MessageID string
+	// Tags are the names of the quote's tags in order
+	Tags []string
 }
 
-// QuoteCache is a construct to hold the most recent quote count
+// quoteEdit is a change to an existing quote
+type quoteEdit struct {
+	// Quote replaces the text unless it is empty
+	Quote string
+	// Tags replace the quote's tags when SetTags is set, removing them all if empty
+	Tags    []string
+	SetTags bool
+}
+
+// JumpLink returns a link to the message the quote was saved from, or an empty string if it was added by hand
+func (q Quote) JumpLink() string {
+	if q.MessageID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", q.GuildID, q.ChannelID, q.MessageID)
+}
+
+// QuoteCache is a construct to hold the most recent quote count of each guild
 type QuoteCache struct {
-	mu          sync.Mutex
+	mu     sync.Mutex
+	guilds map[string]cachedCount
+}
+
+// cachedCount is a single guild's quote count and when it was fetched
+type cachedCount struct {
 	Total       int
 	LastUpdated time.Time
 }
 
-// SQLConn is a wrapper around the database connection
+// get returns the cached count for a guild if it is less than an hour old
+func (c *QuoteCache) get(guild string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.guilds[guild]
+	if !ok || time.Since(entry.LastUpdated) >= time.Hour {
+		cacheLookups.WithLabelValues("miss").Inc()
+		return 0, false
+	}
+	cacheLookups.WithLabelValues("hit").Inc()
+	return entry.Total, true
+}
+
+// set caches the count for a guild
+func (c *QuoteCache) set(guild string, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.guilds == nil {
+		c.guilds = make(map[string]cachedCount)
+	}
+	c.guilds[guild] = cachedCount{Total: total, LastUpdated: time.Now()}
+}
+
+// invalidate drops the cached count for a guild, and the count across every guild, so the next count query hits
+// the DB
+func (c *QuoteCache) invalidate(guild string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.guilds, guild)
+	delete(c.guilds, "")
+}
+
+// SQLConn is a wrapper around the database connection and implements QuoteStore for every supported dialect
 type SQLConn struct {
-	Conn  *sql.DB
-	Table string
-	Cache *QuoteCache
+	Conn    *sql.DB
+	Table   string
+	Cache   *QuoteCache
+	Dialect dialect
 }
 
-// newSQLConn creates a new connection to the database
+// newSQLConn creates a new connection to the SQLite database
 func newSQLConn() (*SQLConn, error) {
-	sqliteFile := os.Getenv("SQLITE_DB")
-	table := os.Getenv("SQLITE_TABLE_NAME")
+	return openSQLConn(dialectSQLite, os.Getenv("SQLITE_DB"), envMigrationEnv("SQLITE_TABLE_NAME"))
+}
+
+// envMigrationEnv builds the migration environment from the table named by tableKey and DISCORD_GUILD
+func envMigrationEnv(tableKey string) migrationEnv {
+	return migrationEnv{Table: os.Getenv(tableKey), LegacyGuild: os.Getenv("DISCORD_GUILD")}
+}
+
+// openSQLConn opens a database in the given dialect and migrates it to the latest schema
+func openSQLConn(d dialect, dsn string, env migrationEnv) (*SQLConn, error) {
+	db, err := sql.Open(d.driverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ctxWithTimeout()
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	db, err := sql.Open("sqlite3", sqliteFile)
+	slog.Info("connected to database", "dialect", d)
+
+	if err := migrate(ctx, db, env, d.migrations()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error migrating database: %w", err)
+	}
+
+	version, err := schemaVersion(ctx, db, env.Table)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
+	slog.Info("database schema is up to date", "version", version)
+
+	return &SQLConn{Conn: db, Table: env.Table, Cache: &QuoteCache{}, Dialect: d}, nil
+}
+
+// Close closes the underlying database connection
+func (db *SQLConn) Close() error {
+	return db.Conn.Close()
+}
+
+// quoteColumns is the column list every quote query selects, in the order scanQuote expects. The last column joins
+// the names of the quote's tags with commas.
+func (db *SQLConn) quoteColumns() string {
+	return fmt.Sprintf(`id,quote,quotee,quoter,createdAt,guild,channelID,messageID,
+		COALESCE((SELECT string_agg(t.name, ',' ORDER BY t.name) FROM %s t INNER JOIN %s qt ON qt.tagID = t.id WHERE qt.quoteID = %s.id), '')`,
+		tagsTable(db.Table), quoteTagsTable(db.Table), db.Table)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanQuote scans a row selected with quoteColumns into a Quote
+func scanQuote(row rowScanner) (Quote, error) {
+	var quote Quote
+	var tags string
+	err := row.Scan(&quote.ID, &quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt, &quote.GuildID, &quote.ChannelID, &quote.MessageID, &tags)
+	if tags != "" {
+		quote.Tags = strings.Split(tags, ",")
+	}
+	return quote, err
+}
+
+// queryQuotes runs a query selecting quoteColumns and scans every row
+func (db *SQLConn) queryQuotes(ctx context.Context, query string, args ...any) ([]Quote, error) {
+	var quotes []Quote
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return quotes, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		quote, err := scanQuote(rows)
+		if err != nil {
+			return quotes, err
+		}
+		quotes = append(quotes, quote)
+	}
 
-	log.Printf("Connected to SQLite database %s", sqliteFile)
+	if err = rows.Err(); err != nil {
+		return quotes, err
+	}
 
-	return &SQLConn{Conn: db, Table: table, Cache: &QuoteCache{}}, nil
+	return quotes, nil
 }
 
-// createQuote creates a quote in the database
-func (db *SQLConn) createQuote(ctx context.Context, quote Quote) error {
-	// reset the cache timer so the next count query hits the DB
-	db.Cache.mu.Lock()
-	db.Cache.LastUpdated = time.Time{}
-	db.Cache.mu.Unlock()
+// createQuote creates a quote and links it to its tags in the database, and returns its ID
+func (db *SQLConn) createQuote(ctx context.Context, quote Quote) (int64, error) {
+	defer observeQuery("createQuote")()
 
-	log.Printf("Creating quote: %v", quote)
+	slog.InfoContext(ctx, "creating quote", "quotee", quote.Quotee, "quoter", quote.Quoter)
 
-	query := fmt.Sprintf(`INSERT INTO %s (quote, quotee, quoter, createdAt) VALUES (?, ?, ?, ?)`, db.Table)
-	_, err := db.Conn.ExecContext(ctx, query, quote.Quote, quote.Quotee, quote.Quoter, quote.CreatedAt)
+	var id int64
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		query := db.Dialect.rebind(fmt.Sprintf(`INSERT INTO %s (quote, quotee, quoter, createdAt, guild, channelID, messageID) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`, db.Table))
+		err := tx.QueryRowContext(ctx, query, quote.Quote, quote.Quotee, quote.Quoter, quote.CreatedAt, quote.GuildID, quote.ChannelID, quote.MessageID).Scan(&id)
+		if err != nil {
+			return err
+		}
+		return db.linkTags(ctx, tx, quote.GuildID, id, quote.Tags)
+	})
 	if err != nil {
-		log.Printf("Error creating quote: %v", err)
+		return 0, fmt.Errorf("createQuote: %w", err)
+	}
+	// only once the quote is committed, or a count in between would cache the old total again
+	db.Cache.invalidate(quote.GuildID)
+
+	return id, nil
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds and rolling it back otherwise
+func (db *SQLConn) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
 		return err
 	}
+	return tx.Commit()
+}
 
+// linkTags tags a quote, creating any of the tags the guild does not have yet
+func (db *SQLConn) linkTags(ctx context.Context, tx *sql.Tx, guild string, id int64, tags []string) error {
+	create := db.Dialect.rebind(fmt.Sprintf(`INSERT INTO %s (guild, name) VALUES (?, ?) ON CONFLICT DO NOTHING`, tagsTable(db.Table)))
+	link := db.Dialect.rebind(fmt.Sprintf(`INSERT INTO %s (quoteID, tagID) SELECT ?, id FROM %s WHERE guild = ? AND name = ?`,
+		quoteTagsTable(db.Table), tagsTable(db.Table)))
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, create, guild, tag); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, link, id, guild, tag); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// getRandQuote gets a quote from the database
-func (db *SQLConn) getRandQuote(ctx context.Context) (Quote, error) {
-	var quote Quote
-	query := fmt.Sprintf(`SELECT quote,quotee,quoter,createdAt FROM %s ORDER BY RANDOM() LIMIT 1`, db.Table)
-	row := db.Conn.QueryRowContext(ctx, query)
-	if err := row.Scan(&quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt); err != nil {
+// unlinkTags removes every tag from a quote and then drops the guild's tags that no quote has any more
+func (db *SQLConn) unlinkTags(ctx context.Context, tx *sql.Tx, guild string, id int64) error {
+	query := db.Dialect.rebind(fmt.Sprintf(`DELETE FROM %s WHERE quoteID = ?`, quoteTagsTable(db.Table)))
+	if _, err := tx.ExecContext(ctx, query, id); err != nil {
+		return err
+	}
+	query = db.Dialect.rebind(fmt.Sprintf(`DELETE FROM %s WHERE guild = ? AND id NOT IN (SELECT tagID FROM %s)`,
+		tagsTable(db.Table), quoteTagsTable(db.Table)))
+	_, err := tx.ExecContext(ctx, query, guild)
+	return err
+}
+
+// tagFilter returns a condition selecting the quotes with a tag and its arguments, or nothing when tag is empty
+func (db *SQLConn) tagFilter(guild string, tag string) (string, []any) {
+	if tag == "" {
+		return "", nil
+	}
+	return fmt.Sprintf(` AND id IN (SELECT qt.quoteID FROM %s qt INNER JOIN %s t ON t.id = qt.tagID WHERE t.guild = ? AND t.name = ?)`,
+		quoteTagsTable(db.Table), tagsTable(db.Table)), []any{guild, tag}
+}
+
+// getQuote gets a single quote by its ID
+func (db *SQLConn) getQuote(ctx context.Context, guild string, id int64) (Quote, error) {
+	defer observeQuery("getQuote")()
+
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? AND id = ?`, db.quoteColumns(), db.Table))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, query, guild, id))
+	if err != nil {
+		return quote, fmt.Errorf("getQuote: %w", err)
+	}
+
+	return quote, nil
+}
+
+// editQuote applies an edit to a quote in one transaction, so a failed edit leaves the quote as it was. It returns
+// sql.ErrNoRows if the quote does not exist.
+func (db *SQLConn) editQuote(ctx context.Context, guild string, id int64, edit quoteEdit) error {
+	defer observeQuery("editQuote")()
+
+	slog.InfoContext(ctx, "editing quote", "id", id, "tags", edit.Tags)
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		if edit.Quote != "" {
+			query := db.Dialect.rebind(fmt.Sprintf(`UPDATE %s SET quote = ? WHERE guild = ? AND id = ?`, db.Table))
+			res, err := tx.ExecContext(ctx, query, edit.Quote, guild, id)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return sql.ErrNoRows
+			}
+		} else {
+			var exists int
+			query := db.Dialect.rebind(fmt.Sprintf(`SELECT 1 FROM %s WHERE guild = ? AND id = ?`, db.Table))
+			if err := tx.QueryRowContext(ctx, query, guild, id).Scan(&exists); err != nil {
+				return err
+			}
+		}
+
+		if !edit.SetTags {
+			return nil
+		}
+		if err := db.unlinkTags(ctx, tx, guild, id); err != nil {
+			return err
+		}
+		return db.linkTags(ctx, tx, guild, id, edit.Tags)
+	})
+	if err != nil {
+		return fmt.Errorf("editQuote: %w", err)
+	}
+	db.Cache.invalidate(guild)
+	return nil
+}
+
+// deleteQuote removes a quote and its tags. It returns sql.ErrNoRows if the quote does not exist.
+func (db *SQLConn) deleteQuote(ctx context.Context, guild string, id int64) error {
+	defer observeQuery("deleteQuote")()
+
+	slog.InfoContext(ctx, "deleting quote", "id", id)
+
+	err := db.inTx(ctx, func(tx *sql.Tx) error {
+		query := db.Dialect.rebind(fmt.Sprintf(`DELETE FROM %s WHERE guild = ? AND id = ?`, db.Table))
+		res, err := tx.ExecContext(ctx, query, guild, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		return db.unlinkTags(ctx, tx, guild, id)
+	})
+	if err != nil {
+		return fmt.Errorf("deleteQuote: %w", err)
+	}
+	db.Cache.invalidate(guild)
+	return nil
+}
+
+// listTags counts the quotes with each of a guild's tags, most used first with ties in name order
+func (db *SQLConn) listTags(ctx context.Context, guild string) ([]tagCount, error) {
+	defer observeQuery("listTags")()
+
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT t.name, COUNT(*) AS count FROM %s t INNER JOIN %s qt ON qt.tagID = t.id
+		WHERE t.guild = ? GROUP BY t.name ORDER BY count DESC, t.name`, tagsTable(db.Table), quoteTagsTable(db.Table)))
+	rows, err := db.Conn.QueryContext(ctx, query, guild)
+	if err != nil {
+		return nil, fmt.Errorf("listTags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []tagCount
+	for rows.Next() {
+		var t tagCount
+		if err := rows.Scan(&t.Name, &t.Count); err != nil {
+			return nil, fmt.Errorf("listTags: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listTags: %w", err)
+	}
+	return tags, nil
+}
+
+// getRandQuote gets a quote from the database, one with the tag unless it is empty
+func (db *SQLConn) getRandQuote(ctx context.Context, guild string, tag string) (Quote, error) {
+	defer observeQuery("getRandQuote")()
+
+	filter, args := db.tagFilter(guild, tag)
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ?%s ORDER BY RANDOM() LIMIT 1`, db.quoteColumns(), db.Table, filter))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, query, append([]any{guild}, args...)...))
+	if err != nil {
 		return quote, fmt.Errorf("getRandQuote: %w", err)
 	}
 
 	return quote, nil
 }
 
-// getRandUserQuote gets a quote from the database for a specific user
-func (db *SQLConn) getRandUserQuote(ctx context.Context, quotee string) (Quote, error) {
-	var quote Quote
+// getRandUserQuote gets a quote from the database for a specific user, one with the tag unless it is empty
+func (db *SQLConn) getRandUserQuote(ctx context.Context, guild string, quotee string, tag string) (Quote, error) {
+	defer observeQuery("getRandUserQuote")()
+
 	id := fmt.Sprintf("<@%s>", quotee)
-	query := fmt.Sprintf(`SELECT quote,quotee,quoter,createdAt FROM %s WHERE quotee = ? ORDER BY RANDOM() LIMIT 1`, db.Table)
-	err := db.Conn.QueryRowContext(ctx, query, id).Scan(&quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt)
+	filter, args := db.tagFilter(guild, tag)
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? AND quotee = ?%s ORDER BY RANDOM() LIMIT 1`, db.quoteColumns(), db.Table, filter))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, query, append([]any{guild, id}, args...)...))
 	if err != nil {
 		return quote, fmt.Errorf("getRandUserQuote: %w", err)
 	}
@@ -96,12 +412,14 @@ func (db *SQLConn) getRandUserQuote(ctx context.Context, quotee string) (Quote,
 	return quote, nil
 }
 
-// getLatestUserQuote gets the latest quote from the database for a specific user
-func (db *SQLConn) getLatestUserQuote(ctx context.Context, quotee string) (Quote, error) {
-	var quote Quote
+// getLatestUserQuote gets the latest quote from the database for a specific user, by when it was created
+func (db *SQLConn) getLatestUserQuote(ctx context.Context, guild string, quotee string) (Quote, error) {
+	defer observeQuery("getLatestUserQuote")()
+
 	id := fmt.Sprintf("<@%s>", quotee)
-	query := fmt.Sprintf(`SELECT quote,quotee,quoter,createdAt FROM %s WHERE quotee = ? ORDER BY id DESC LIMIT 1`, db.Table)
-	err := db.Conn.QueryRowContext(ctx, query, id).Scan(&quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt)
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? AND quotee = ? ORDER BY %s DESC, id DESC LIMIT 1`,
+		db.quoteColumns(), db.Table, db.Dialect.timeValue("createdAt")))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, query, guild, id))
 	if err != nil {
 		return quote, fmt.Errorf("getLatestUserQuote: %w", err)
 	}
@@ -109,11 +427,13 @@ func (db *SQLConn) getLatestUserQuote(ctx context.Context, quotee string) (Quote
 	return quote, nil
 }
 
-// getLatestQuote gets the latest quote from the database
-func (db *SQLConn) getLatestQuote(ctx context.Context) (Quote, error) {
-	var quote Quote
-	query := fmt.Sprintf(`SELECT quote,quotee,quoter,createdAt FROM %s ORDER BY id DESC LIMIT 1`, db.Table)
-	err := db.Conn.QueryRowContext(ctx, query).Scan(&quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt)
+// getLatestQuote gets the latest quote from the database, by when it was created
+func (db *SQLConn) getLatestQuote(ctx context.Context, guild string) (Quote, error) {
+	defer observeQuery("getLatestQuote")()
+
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? ORDER BY %s DESC, id DESC LIMIT 1`,
+		db.quoteColumns(), db.Table, db.Dialect.timeValue("createdAt")))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, query, guild))
 	if err != nil {
 		return quote, fmt.Errorf("getLatestQuote: %w", err)
 	}
@@ -121,95 +441,325 @@ func (db *SQLConn) getLatestQuote(ctx context.Context) (Quote, error) {
 	return quote, nil
 }
 
-// searchQuote searches the database for string (s) and returns the top 10 results
-func (db *SQLConn) searchQuote(ctx context.Context, s string) ([]Quote, error) {
-	var quotes []Quote
-	query := fmt.Sprintf(`SELECT quote,quotee,quoter,createdAt FROM %s WHERE quote LIKE ? ORDER BY id DESC LIMIT %d`, db.Table, resultLimit)
-	rows, err := db.Conn.QueryContext(ctx, query, "%"+s+"%")
-	if err != nil {
-		return quotes, err
+// searchMatches returns the FROM and WHERE clauses selecting the quotes that match q, only those with the tag unless
+// it is empty, and their arguments
+func (db *SQLConn) searchMatches(guild string, q searchQuery, tag string) (string, string, []any) {
+	filter, filterArgs := db.tagFilter(guild, tag)
+	if db.Dialect == dialectPostgres {
+		where := fmt.Sprintf("guild = ? AND %s @@ websearch_to_tsquery('english', ?)%s", pgSearchVector, filter)
+		return db.Table, where, append([]any{guild, q.websearch()}, filterArgs...)
 	}
+	from := fmt.Sprintf("%s INNER JOIN (SELECT rowid, rank FROM %s_fts WHERE %s_fts MATCH ?) AS m ON m.rowid = id", db.Table, db.Table, db.Table)
+	return from, "guild = ?" + filter, append([]any{q.fts5(), guild}, filterArgs...)
+}
 
-	defer rows.Close()
+// searchQuote runs a full-text search for s and returns up to searchLimit results in the requested order, only
+// those with the tag unless it is empty
+func (db *SQLConn) searchQuote(ctx context.Context, guild string, s string, order searchOrder, tag string) ([]Quote, error) {
+	defer observeQuery("searchQuote")()
 
-	for rows.Next() {
-		var quote Quote
-		err := rows.Scan(&quote.Quote, &quote.Quotee, &quote.Quoter, &quote.CreatedAt)
-		if err != nil {
-			return quotes, err
+	q := parseSearchQuery(s)
+	if len(q) == 0 {
+		return nil, nil
+	}
+	from, where, args := db.searchMatches(guild, q, tag)
+
+	orderBy := db.Dialect.timeValue("createdAt") + " DESC, id DESC"
+	if order == searchByRelevance {
+		if db.Dialect == dialectPostgres {
+			orderBy = fmt.Sprintf("ts_rank(%s, websearch_to_tsquery('english', ?)) DESC, id DESC", pgSearchVector)
+			args = append(args, q.websearch())
+		} else {
+			// bm25 rank is more negative for better matches, so ascending order puts the best first
+			orderBy = "m.rank, id DESC"
 		}
-		quotes = append(quotes, quote)
 	}
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT %d`, db.quoteColumns(), from, where, orderBy, searchLimit))
+	return db.queryQuotes(ctx, query, args...)
+}
 
-	if err = rows.Err(); err != nil {
-		return quotes, err
+// searchCount returns how many quotes match s, only counting those with the tag unless it is empty
+func (db *SQLConn) searchCount(ctx context.Context, guild string, s string, tag string) (int, error) {
+	defer observeQuery("searchCount")()
+
+	q := parseSearchQuery(s)
+	if len(q) == 0 {
+		return 0, nil
 	}
+	from, where, args := db.searchMatches(guild, q, tag)
 
-	return quotes, nil
+	var count int
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, from, where))
+	if err := db.Conn.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("searchCount: %w", err)
+	}
+	return count, nil
 }
 
-// getLeaderboard generates a leaderboard of the top 10 quotees
-func (db *SQLConn) getLeaderboard(ctx context.Context) (string, error) {
-	var leaderboard []string
-	var cleanLB string
+// leaderboardFilter returns the WHERE clause selecting the quotes a leaderboard counts, and its arguments
+func (db *SQLConn) leaderboardFilter(guild string, q leaderboardQuery) (string, []any) {
+	where, args := "guild = ?", []any{guild}
+	if !q.From.IsZero() {
+		where += fmt.Sprintf(" AND %s >= %s", db.Dialect.timeValue("createdAt"), db.Dialect.timeValue("?"))
+		args = append(args, q.From)
+	}
+	if !q.To.IsZero() {
+		where += fmt.Sprintf(" AND %s < %s", db.Dialect.timeValue("createdAt"), db.Dialect.timeValue("?"))
+		args = append(args, q.To)
+	}
+	return where, args
+}
+
+// getLeaderboard generates a leaderboard of the top 10 quotees or quoters
+func (db *SQLConn) getLeaderboard(ctx context.Context, guild string, q leaderboardQuery) ([]leaderboardEntry, error) {
+	defer observeQuery("getLeaderboard")()
+
+	var leaderboard []leaderboardEntry
 
-	query := fmt.Sprintf(`SELECT quotee, COUNT(*) as count FROM %s GROUP BY quotee ORDER BY count DESC LIMIT %d`, db.Table, resultLimit)
-	rows, err := db.Conn.QueryContext(ctx, query)
+	where, args := db.leaderboardFilter(guild, q)
+	col := q.Mode.column()
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s, COUNT(*) as count FROM %s WHERE %s GROUP BY %s ORDER BY count DESC, %s LIMIT %d`,
+		col, db.Table, where, col, col, resultLimit))
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return cleanLB, fmt.Errorf("error getting leaderboard: %w", err)
+		return nil, fmt.Errorf("error getting leaderboard: %w", err)
 	}
 
 	defer rows.Close()
 
-	position := 0
 	for rows.Next() {
-		var quotee string
-		var count int
-		position++
-		err := rows.Scan(&quotee, &count)
+		var entry leaderboardEntry
+		err := rows.Scan(&entry.User, &entry.Count)
 		if err != nil {
-			return cleanLB, fmt.Errorf("error scanning leaderboard row: %w", err)
+			return nil, fmt.Errorf("error scanning leaderboard row: %w", err)
 		}
-		leaderboard = append(leaderboard, fmt.Sprintf("`%d:` %s: %d", position, quotee, count))
+		leaderboard = append(leaderboard, entry)
 	}
 
 	if err = rows.Err(); err != nil {
-		return cleanLB, fmt.Errorf("error iterating over leaderboard rows: %w", err)
+		return nil, fmt.Errorf("error iterating over leaderboard rows: %w", err)
+	}
+
+	return leaderboard, nil
+}
+
+// getLeaderboardRank finds a user's place on a leaderboard, or rank 0 if they have no quotes on it. Ties are ranked
+// in the same order getLeaderboard lists them.
+func (db *SQLConn) getLeaderboardRank(ctx context.Context, guild string, q leaderboardQuery, user string) (leaderboardEntry, int, error) {
+	defer observeQuery("getLeaderboardRank")()
+
+	entry := leaderboardEntry{User: fmt.Sprintf("<@%s>", user)}
+	where, args := db.leaderboardFilter(guild, q)
+	query := db.Dialect.rebind(fmt.Sprintf(`WITH counts AS (SELECT %s AS name, COUNT(*) AS count FROM %s WHERE %s GROUP BY %s)
+		SELECT c.count, (SELECT COUNT(*) FROM counts o WHERE o.count > c.count OR (o.count = c.count AND o.name < c.name)) + 1
+		FROM counts c WHERE c.name = ?`, q.Mode.column(), db.Table, where, q.Mode.column()))
+
+	var rank int
+	err := db.Conn.QueryRowContext(ctx, query, append(args, entry.User)...).Scan(&entry.Count, &rank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, 0, nil
+	}
+	if err != nil {
+		return entry, 0, fmt.Errorf("getLeaderboardRank: %w", err)
+	}
+	return entry, rank, nil
+}
+
+// getProfile sums up a user's quotes: their all-time ranks as quotee and quoter, their first and latest quote, the
+// month they were quoted most and who quotes them most
+func (db *SQLConn) getProfile(ctx context.Context, guild string, user string) (userProfile, error) {
+	defer observeQuery("getProfile")()
+
+	var p userProfile
+	var err error
+	if p.Quotee, p.QuoteeRank, err = db.getLeaderboardRank(ctx, guild, leaderboardQuery{Mode: rankQuotees}, user); err != nil {
+		return p, fmt.Errorf("getProfile: %w", err)
+	}
+	if p.Quoter, p.QuoterRank, err = db.getLeaderboardRank(ctx, guild, leaderboardQuery{Mode: rankQuoters}, user); err != nil {
+		return p, fmt.Errorf("getProfile: %w", err)
+	}
+	if p.QuoteeRank == 0 {
+		return p, nil
+	}
+
+	// order by when quotes were created, as imports number them in the order they were added
+	mention := p.Quotee.User
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? AND quotee = ? ORDER BY %s, id LIMIT 1`,
+		db.quoteColumns(), db.Table, db.Dialect.timeValue("createdAt")))
+	if p.First, err = scanQuote(db.Conn.QueryRowContext(ctx, query, guild, mention)); err != nil {
+		return p, fmt.Errorf("getProfile: first quote: %w", err)
+	}
+	if p.Latest, err = db.getLatestUserQuote(ctx, guild, user); err != nil {
+		return p, fmt.Errorf("getProfile: %w", err)
+	}
+
+	month := db.Dialect.intervalStart("createdAt", statsMonth)
+	query = db.Dialect.rebind(fmt.Sprintf(`SELECT %s AS month, COUNT(*) AS count FROM %s WHERE guild = ? AND quotee = ?
+		GROUP BY month ORDER BY count DESC, month DESC LIMIT 1`, month, db.Table))
+	var busiest string
+	if err = db.Conn.QueryRowContext(ctx, query, guild, mention).Scan(&busiest, &p.BusiestCount); err != nil {
+		return p, fmt.Errorf("getProfile: busiest month: %w", err)
+	}
+	if p.BusiestMonth, err = time.Parse(time.DateOnly, busiest); err != nil {
+		return p, fmt.Errorf("getProfile: busiest month: %w", err)
 	}
 
-	cleanLB = strings.Join(leaderboard, "\n")
+	query = db.Dialect.rebind(fmt.Sprintf(`SELECT quoter, COUNT(*) AS count FROM %s WHERE guild = ? AND quotee = ? AND quoter <> quotee
+		GROUP BY quoter ORDER BY count DESC, quoter LIMIT 1`, db.Table))
+	err = db.Conn.QueryRowContext(ctx, query, guild, mention).Scan(&p.TopQuoter.User, &p.TopQuoter.Count)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("getProfile: top quoter: %w", err)
+	}
 
-	return cleanLB, nil
+	return p, nil
 }
 
-// quoteCount gets the number of quotes in the database. It caches the max count for one hour.
-func (db *SQLConn) quoteCount(ctx context.Context) (int, error) {
-	db.Cache.mu.Lock()
-	cached := time.Since(db.Cache.LastUpdated) < time.Hour
-	cachedTotal := db.Cache.Total
-	db.Cache.mu.Unlock()
+// getActivity counts the quotes created in each UTC week or month, oldest first, skipping those without any. An
+// empty quotee counts every quote in the guild.
+func (db *SQLConn) getActivity(ctx context.Context, guild string, quotee string, iv statsInterval) ([]activityCount, error) {
+	defer observeQuery("getActivity")()
+
+	where, args := "guild = ?", []any{guild}
+	if quotee != "" {
+		where += " AND quotee = ?"
+		args = append(args, fmt.Sprintf("<@%s>", quotee))
+	}
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s AS start, COUNT(*) FROM %s WHERE %s GROUP BY start ORDER BY start`,
+		db.Dialect.intervalStart("createdAt", iv), db.Table, where))
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getActivity: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []activityCount
+	for rows.Next() {
+		var start string
+		var count activityCount
+		if err := rows.Scan(&start, &count.Count); err != nil {
+			return nil, fmt.Errorf("getActivity: %w", err)
+		}
+		if count.Start, err = time.Parse(time.DateOnly, start); err != nil {
+			return nil, fmt.Errorf("getActivity: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getActivity: %w", err)
+	}
+	return counts, nil
+}
+
+// quoteCount gets the number of quotes in a guild, or in every guild when guild is empty. It caches each count for
+// one hour.
+func (db *SQLConn) quoteCount(ctx context.Context, guild string) (int, error) {
+	defer observeQuery("quoteCount")()
 
 	// if the cache is less than an hour old, return the cached value
-	if cached {
-		log.Println("Returning cached total quotes.")
+	if cachedTotal, ok := db.Cache.get(guild); ok {
+		slog.DebugContext(ctx, "returning cached quote count", "count", cachedTotal)
 		return cachedTotal, nil
 	}
 
-	log.Println("Cache is older than an hour. Fetching total quotes from database")
+	slog.DebugContext(ctx, "quote count cache is stale, counting in the database")
 
 	var count int
-	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s`, db.Table)
-	err := db.Conn.QueryRowContext(ctx, query).Scan(&count)
+	var err error
+	if guild == "" {
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s`, db.Table)
+		err = db.Conn.QueryRowContext(ctx, query).Scan(&count)
+	} else {
+		query := db.Dialect.rebind(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE guild = ?`, db.Table))
+		err = db.Conn.QueryRowContext(ctx, query, guild).Scan(&count)
+	}
 	if err != nil {
 		return 0, fmt.Errorf("quoteCount: %w", err)
 	}
 
 	// cache the result
-	db.Cache.mu.Lock()
-	db.Cache.Total = count
-	db.Cache.LastUpdated = time.Now()
-	db.Cache.mu.Unlock()
-	log.Printf("Cached total quotes at %v. Number of quotes: %d", db.Cache.LastUpdated, count)
+	db.Cache.set(guild, count)
+	slog.DebugContext(ctx, "cached quote count", "count", count)
 
 	return count, nil
 }
+
+// listQuotes gets every quote in a guild, oldest first. An empty guild lists the quotes of every guild.
+func (db *SQLConn) listQuotes(ctx context.Context, guild string) ([]Quote, error) {
+	defer observeQuery("listQuotes")()
+
+	if guild == "" {
+		query := fmt.Sprintf(`SELECT %s FROM %s ORDER BY id`, db.quoteColumns(), db.Table)
+		return db.queryQuotes(ctx, query)
+	}
+
+	query := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE guild = ? ORDER BY id`, db.quoteColumns(), db.Table))
+	return db.queryQuotes(ctx, query, guild)
+}
+
+// getDailyQuote gets the quote of the day for a guild. The first call for a day picks a quote not yet shown in the
+// current cycle and records it, so every later call, and every process sharing the database, gets the same quote.
+// A new cycle starts once every quote in the guild has been picked.
+func (db *SQLConn) getDailyQuote(ctx context.Context, guild string, day time.Time) (Quote, error) {
+	defer observeQuery("getDailyQuote")()
+
+	daily := dailyTable(db.Table)
+	key := dailyKey(day)
+
+	pickedQuery := db.Dialect.rebind(fmt.Sprintf(`SELECT %s FROM %s WHERE id = (SELECT quoteID FROM %s WHERE guild = ? AND day = ?)`, db.quoteColumns(), db.Table, daily))
+	quote, err := scanQuote(db.Conn.QueryRowContext(ctx, pickedQuery, guild, key))
+	if !errors.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return quote, fmt.Errorf("getDailyQuote: %w", err)
+		}
+		return quote, nil
+	}
+
+	// the day has no pick yet, or its quote has since been deleted
+	query := db.Dialect.rebind(fmt.Sprintf(`DELETE FROM %s WHERE guild = ? AND day = ?`, daily))
+	if _, err := db.Conn.ExecContext(ctx, query, guild, key); err != nil {
+		return Quote{}, fmt.Errorf("getDailyQuote: %w", err)
+	}
+
+	var cycle int
+	query = db.Dialect.rebind(fmt.Sprintf(`SELECT COALESCE(MAX(cycle), 0) FROM %s WHERE guild = ?`, daily))
+	if err := db.Conn.QueryRowContext(ctx, query, guild).Scan(&cycle); err != nil {
+		return Quote{}, fmt.Errorf("getDailyQuote: %w", err)
+	}
+
+	unpicked := fmt.Sprintf(`FROM %s WHERE guild = ? AND id NOT IN (SELECT quoteID FROM %s WHERE guild = ? AND cycle = ?)`, db.Table, daily)
+	var remaining int
+	query = db.Dialect.rebind(`SELECT COUNT(*) ` + unpicked)
+	if err := db.Conn.QueryRowContext(ctx, query, guild, guild, cycle).Scan(&remaining); err != nil {
+		return Quote{}, fmt.Errorf("getDailyQuote: %w", err)
+	}
+	if remaining == 0 {
+		// every quote has had its day, or there are none at all
+		cycle++
+		query = db.Dialect.rebind(fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE guild = ?`, db.Table))
+		if err := db.Conn.QueryRowContext(ctx, query, guild).Scan(&remaining); err != nil {
+			return Quote{}, fmt.Errorf("getDailyQuote: %w", err)
+		}
+		if remaining == 0 {
+			return Quote{}, fmt.Errorf("getDailyQuote: %w", sql.ErrNoRows)
+		}
+	}
+
+	offset := dailySeed(guild, key, cycle) % uint64(remaining)
+	query = db.Dialect.rebind(fmt.Sprintf(`SELECT %s %s ORDER BY id LIMIT 1 OFFSET ?`, db.quoteColumns(), unpicked))
+	quote, err = scanQuote(db.Conn.QueryRowContext(ctx, query, guild, guild, cycle, int64(offset)))
+	if err != nil {
+		return quote, fmt.Errorf("getDailyQuote: %w", err)
+	}
+
+	// another process may have picked first, in which case its pick wins
+	query = db.Dialect.rebind(fmt.Sprintf(`INSERT INTO %s (guild, day, cycle, quoteID) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`, daily))
+	if _, err := db.Conn.ExecContext(ctx, query, guild, key, cycle, quote.ID); err != nil {
+		return Quote{}, fmt.Errorf("getDailyQuote: %w", err)
+	}
+
+	quote, err = scanQuote(db.Conn.QueryRowContext(ctx, pickedQuery, guild, key))
+	if err != nil {
+		return quote, fmt.Errorf("getDailyQuote: %w", err)
+	}
+	return quote, nil
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
-// newTestDB creates an in-memory SQLite database with the quotes table.
+// testGuild is the guild every test quote belongs to unless a test is checking guild isolation
+const testGuild = "100"
+
+// newTestDB creates an in-memory SQLite database migrated to the latest schema.
 func newTestDB(t *testing.T) *SQLConn {
 	t.Helper()
 	db, err := sql.Open("sqlite3", ":memory:")
@@ -15,187 +22,810 @@ func newTestDB(t *testing.T) *SQLConn {
 		t.Fatalf("open in-memory db: %v", err)
 	}
 
+	// every connection to :memory: is a separate database, so pin the pool to one
+	db.SetMaxOpenConns(1)
+
 	const table = "quotes"
-	_, err = db.Exec(`CREATE TABLE quotes (
-		id        INTEGER PRIMARY KEY AUTOINCREMENT,
-		quote     TEXT    NOT NULL,
-		quotee    TEXT    NOT NULL,
-		quoter    TEXT    NOT NULL,
-		createdAt TIMESTAMP NOT NULL
-	)`)
+	err = migrate(context.Background(), db, migrationEnv{Table: table}, sqliteMigrations)
 	if err != nil {
-		t.Fatalf("create table: %v", err)
+		t.Fatalf("migrate: %v", err)
 	}
 
-	conn := &SQLConn{Conn: db, Table: table, Cache: &QuoteCache{}}
+	conn := &SQLConn{Conn: db, Table: table, Cache: &QuoteCache{}, Dialect: dialectSQLite}
 	t.Cleanup(func() { db.Close() })
 	return conn
 }
 
-func insertQuote(t *testing.T, conn *SQLConn, q Quote) {
+// storeFactories lists every QuoteStore implementation the shared suite runs against
+var storeFactories = map[string]func(t *testing.T) QuoteStore{
+	"sqlite": func(t *testing.T) QuoteStore { return newTestDB(t) },
+	"memory": func(t *testing.T) QuoteStore { return newMemStore() },
+}
+
+// forEachStore runs fn as a subtest against a fresh instance of every QuoteStore implementation
+func forEachStore(t *testing.T, fn func(t *testing.T, conn QuoteStore)) {
+	t.Helper()
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			fn(t, factory(t))
+		})
+	}
+}
+
+func insertQuote(t *testing.T, conn QuoteStore, q Quote) {
 	t.Helper()
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := conn.createQuote(ctx, q); err != nil {
+	if _, err := conn.createQuote(ctx, q); err != nil {
 		t.Fatalf("insertQuote: %v", err)
 	}
 }
 
 func TestCreateAndCountQuotes(t *testing.T) {
-	conn := newTestDB(t)
-	ctx := context.Background()
-
-	count, err := conn.quoteCount(ctx)
-	if err != nil {
-		t.Fatalf("quoteCount: %v", err)
-	}
-	if count != 0 {
-		t.Errorf("expected 0 quotes, got %d", count)
-	}
-
-	insertQuote(t, conn, Quote{Quote: "hello", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-
-	// cache was reset on insert, so count should hit DB
-	count, err = conn.quoteCount(ctx)
-	if err != nil {
-		t.Fatalf("quoteCount after insert: %v", err)
-	}
-	if count != 1 {
-		t.Errorf("expected 1 quote, got %d", count)
-	}
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		count, err := conn.quoteCount(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+		if count != 0 {
+			t.Errorf("expected 0 quotes, got %d", count)
+		}
+
+		insertQuote(t, conn, Quote{Quote: "hello", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		// cache was reset on insert, so count should hit DB
+		count, err = conn.quoteCount(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("quoteCount after insert: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 quote, got %d", count)
+		}
+	})
 }
 
 func TestQuoteCountCaching(t *testing.T) {
 	conn := newTestDB(t)
 	ctx := context.Background()
 
-	insertQuote(t, conn, Quote{Quote: "cached", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
+	insertQuote(t, conn, Quote{Quote: "cached", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
 
 	// prime the cache
-	if _, err := conn.quoteCount(ctx); err != nil {
+	if _, err := conn.quoteCount(ctx, testGuild); err != nil {
 		t.Fatalf("prime cache: %v", err)
 	}
 
 	// insert another quote without resetting cache (simulate stale cache)
-	_, err := conn.Conn.Exec(`INSERT INTO quotes (quote, quotee, quoter, createdAt) VALUES (?, ?, ?, ?)`,
-		"uncached", "<@1>", "<@2>", time.Now())
+	_, err := conn.Conn.Exec(`INSERT INTO quotes (quote, quotee, quoter, createdAt, guild) VALUES (?, ?, ?, ?, ?)`,
+		"uncached", "<@1>", "<@2>", time.Now(), testGuild)
 	if err != nil {
 		t.Fatalf("raw insert: %v", err)
 	}
 
 	// count should return cached value (1), not 2
-	count, err := conn.quoteCount(ctx)
+	count, err := conn.quoteCount(ctx, testGuild)
 	if err != nil {
 		t.Fatalf("quoteCount from cache: %v", err)
 	}
 	if count != 1 {
 		t.Errorf("expected cached count 1, got %d", count)
 	}
+
+	// a write that changes nothing leaves the cache alone, and one that commits drops it
+	if err := conn.deleteQuote(ctx, testGuild, 99); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("deleteQuote of a missing quote: err = %v, want sql.ErrNoRows", err)
+	}
+	if count, _ := conn.quoteCount(ctx, testGuild); count != 1 {
+		t.Errorf("count after a failed delete = %d, want the cached 1", count)
+	}
+	insertQuote(t, conn, Quote{Quote: "third", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+	if count, _ := conn.quoteCount(ctx, testGuild); count != 3 {
+		t.Errorf("count after an insert = %d, want 3", count)
+	}
 }
 
 func TestGetRandQuote(t *testing.T) {
-	conn := newTestDB(t)
-	ctx := context.Background()
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		// empty table should return sql.ErrNoRows
+		_, err := conn.getRandQuote(ctx, testGuild, "")
+		if err == nil {
+			t.Fatal("expected error on empty table, got nil")
+		}
+
+		insertQuote(t, conn, Quote{Quote: "hi", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		q, err := conn.getRandQuote(ctx, testGuild, "")
+		if err != nil {
+			t.Fatalf("getRandQuote: %v", err)
+		}
+		if q.Quote != "hi" {
+			t.Errorf("Quote = %q, want %q", q.Quote, "hi")
+		}
+	})
+}
 
-	// empty table should return sql.ErrNoRows
-	_, err := conn.getRandQuote(ctx)
-	if err == nil {
-		t.Fatal("expected error on empty table, got nil")
-	}
+func TestGetLatestQuote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "first", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "second", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		// added last but created earlier, as an import would
+		insertQuote(t, conn, Quote{Quote: "imported", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now().Add(-time.Hour), GuildID: testGuild})
+
+		q, err := conn.getLatestQuote(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("getLatestQuote: %v", err)
+		}
+		if q.Quote != "second" {
+			t.Errorf("latest quote = %q, want %q", q.Quote, "second")
+		}
+	})
+}
 
-	insertQuote(t, conn, Quote{Quote: "hi", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
+func TestGetLatestUserQuote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "user1 first", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "user1 second", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "user2 only", Quotee: "<@2>", Quoter: "<@1>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		q, err := conn.getLatestUserQuote(ctx, testGuild, "1")
+		if err != nil {
+			t.Fatalf("getLatestUserQuote: %v", err)
+		}
+		if q.Quote != "user1 second" {
+			t.Errorf("latest user quote = %q, want %q", q.Quote, "user1 second")
+		}
+
+		// unknown user should return sql.ErrNoRows
+		_, err = conn.getLatestUserQuote(ctx, testGuild, "999")
+		if err == nil {
+			t.Fatal("expected error for unknown user, got nil")
+		}
+	})
+}
 
-	q, err := conn.getRandQuote(ctx)
-	if err != nil {
-		t.Fatalf("getRandQuote: %v", err)
-	}
-	if q.Quote != "hi" {
-		t.Errorf("Quote = %q, want %q", q.Quote, "hi")
-	}
+func TestSearchQuote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "hello world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "goodbye world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "nothing matches", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		results, err := conn.searchQuote(ctx, testGuild, "world", searchByRelevance, "")
+		if err != nil {
+			t.Fatalf("searchQuote: %v", err)
+		}
+		if len(results) != 2 {
+			t.Errorf("expected 2 results, got %d", len(results))
+		}
+
+		// no match
+		results, err = conn.searchQuote(ctx, testGuild, "zzznomatch", searchByRelevance, "")
+		if err != nil {
+			t.Fatalf("searchQuote no match: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("expected 0 results, got %d", len(results))
+		}
+	})
 }
 
-func TestGetLatestQuote(t *testing.T) {
-	conn := newTestDB(t)
-	ctx := context.Background()
+func TestGetLeaderboard(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "a", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "b", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "c", Quotee: "<@2>", Quoter: "<@1>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		lb, err := conn.getLeaderboard(ctx, testGuild, leaderboardQuery{})
+		if err != nil {
+			t.Fatalf("getLeaderboard: %v", err)
+		}
+		if len(lb) != 2 {
+			t.Fatalf("expected 2 leaderboard entries, got %v", lb)
+		}
+		// user 1 has 2 quotes and should appear first
+		if lb[0] != (leaderboardEntry{User: "<@1>", Count: 2}) {
+			t.Errorf("leaderboard doesn't start with <@1> at 2 quotes: %v", lb)
+		}
+	})
+}
 
-	insertQuote(t, conn, Quote{Quote: "first", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "second", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
+func TestLeaderboardWindows(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+		// stored in another zone, so windows must compare instants rather than text
+		eastern := time.FixedZone("UTC-5", -5*60*60)
+
+		insertQuote(t, conn, Quote{Quote: "a", Quotee: "<@1>", Quoter: "<@9>", CreatedAt: now.AddDate(0, 0, -30), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "b", Quotee: "<@1>", Quoter: "<@9>", CreatedAt: now.AddDate(0, 0, -30), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "c", Quotee: "<@2>", Quoter: "<@8>", CreatedAt: now.AddDate(0, 0, -2).In(eastern), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "d", Quotee: "<@3>", Quoter: "<@8>", CreatedAt: now.Add(-time.Hour).In(eastern), GuildID: testGuild})
+
+		week := now.AddDate(0, 0, -7)
+		tests := []struct {
+			name string
+			q    leaderboardQuery
+			want string
+		}{
+			{"all-time", leaderboardQuery{}, "`1:` <@1>: 2\n`2:` <@2>: 1\n`3:` <@3>: 1"},
+			{"since a week ago", leaderboardQuery{From: week}, "`1:` <@2>: 1\n`2:` <@3>: 1"},
+			{"until a week ago", leaderboardQuery{To: week}, "`1:` <@1>: 2"},
+			{"an hour either side of a quote", leaderboardQuery{From: now.Add(-2 * time.Hour), To: now}, "`1:` <@3>: 1"},
+			{"quoters", leaderboardQuery{Mode: rankQuoters}, "`1:` <@8>: 2\n`2:` <@9>: 2"},
+			{"quoters this week", leaderboardQuery{Mode: rankQuoters, From: week}, "`1:` <@8>: 2"},
+		}
+		for _, tt := range tests {
+			lb, err := conn.getLeaderboard(ctx, testGuild, tt.q)
+			if err != nil {
+				t.Fatalf("%s: getLeaderboard: %v", tt.name, err)
+			}
+			if got := formatLeaderboard(lb); got != tt.want {
+				t.Errorf("%s: leaderboard = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	})
+}
 
-	q, err := conn.getLatestQuote(ctx)
-	if err != nil {
-		t.Fatalf("getLatestQuote: %v", err)
-	}
-	if q.Quote != "second" {
-		t.Errorf("latest quote = %q, want %q", q.Quote, "second")
-	}
+func TestLeaderboardRank(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		// eleven users with two quotes each push user 99 and its single quote to 12th place
+		for user := 10; user <= 20; user++ {
+			for range 2 {
+				insertQuote(t, conn, Quote{Quote: "q", Quotee: fmt.Sprintf("<@%d>", user), Quoter: "<@1>", CreatedAt: time.Now(), GuildID: testGuild})
+			}
+		}
+		insertQuote(t, conn, Quote{Quote: "q", Quotee: "<@99>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		lb, err := conn.getLeaderboard(ctx, testGuild, leaderboardQuery{})
+		if err != nil {
+			t.Fatalf("getLeaderboard: %v", err)
+		}
+		if len(lb) != resultLimit {
+			t.Fatalf("got %d entries, want %d", len(lb), resultLimit)
+		}
+
+		tests := []struct {
+			user     string
+			q        leaderboardQuery
+			rank     int
+			wantUser string
+			count    int
+		}{
+			{"99", leaderboardQuery{}, 12, "<@99>", 1},
+			{"11", leaderboardQuery{}, 2, "<@11>", 2},
+			{"20", leaderboardQuery{}, 11, "<@20>", 2},
+			{"2", leaderboardQuery{Mode: rankQuoters}, 2, "<@2>", 1},
+			{"5", leaderboardQuery{}, 0, "<@5>", 0},
+			{"99", leaderboardQuery{To: time.Now().AddDate(0, 0, -1)}, 0, "<@99>", 0},
+		}
+		for _, tt := range tests {
+			entry, rank, err := conn.getLeaderboardRank(ctx, testGuild, tt.q, tt.user)
+			if err != nil {
+				t.Fatalf("getLeaderboardRank(%s): %v", tt.user, err)
+			}
+			if rank != tt.rank || entry != (leaderboardEntry{User: tt.wantUser, Count: tt.count}) {
+				t.Errorf("rank of %s = %d %+v, want %d with %d quotes", tt.user, rank, entry, tt.rank, tt.count)
+			}
+		}
+	})
 }
 
-func TestGetLatestUserQuote(t *testing.T) {
-	conn := newTestDB(t)
-	ctx := context.Background()
+func TestGetProfile(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		utc2 := time.FixedZone("UTC+2", 2*60*60)
+		day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 12, 0, 0, 0, time.UTC) }
+
+		for _, q := range []Quote{
+			{Quote: "first", Quotee: "<@7>", Quoter: "<@8>", CreatedAt: day(time.January, 15)},
+			// still February in UTC, which months are counted in
+			{Quote: "leap", Quotee: "<@7>", Quoter: "<@8>", CreatedAt: time.Date(2024, time.March, 1, 0, 30, 0, 123456789, utc2)},
+			{Quote: "third", Quotee: "<@7>", Quoter: "<@9>", CreatedAt: day(time.February, 10)},
+			{Quote: "self", Quotee: "<@7>", Quoter: "<@7>", CreatedAt: day(time.March, 20)},
+			{Quote: "other", Quotee: "<@8>", Quoter: "<@7>", CreatedAt: day(time.March, 21)},
+			// added last but created first, as an import would
+			{Quote: "self again", Quotee: "<@7>", Quoter: "<@7>", CreatedAt: day(time.January, 10)},
+		} {
+			q.GuildID = testGuild
+			insertQuote(t, conn, q)
+		}
+		insertQuote(t, conn, Quote{Quote: "elsewhere", Quotee: "<@7>", Quoter: "<@9>", CreatedAt: day(time.April, 1), GuildID: "other"})
+
+		p, err := conn.getProfile(ctx, testGuild, "7")
+		if err != nil {
+			t.Fatalf("getProfile: %v", err)
+		}
+		if p.Quotee != (leaderboardEntry{User: "<@7>", Count: 5}) || p.QuoteeRank != 1 {
+			t.Errorf("quotee = %+v rank %d, want 5 quotes at rank 1", p.Quotee, p.QuoteeRank)
+		}
+		if p.Quoter != (leaderboardEntry{User: "<@7>", Count: 3}) || p.QuoterRank != 1 {
+			t.Errorf("quoter = %+v rank %d, want 3 quotes at rank 1", p.Quoter, p.QuoterRank)
+		}
+		if p.First.Quote != "self again" || p.Latest.Quote != "self" {
+			t.Errorf("first and latest = %q and %q", p.First.Quote, p.Latest.Quote)
+		}
+		// January and February tie on two quotes each, and the later month wins
+		if want := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC); !p.BusiestMonth.Equal(want) || p.BusiestCount != 2 {
+			t.Errorf("busiest month = %v with %d, want %v with 2", p.BusiestMonth, p.BusiestCount, want)
+		}
+		// quoting yourself does not count, or <@7> would tie <@8> and win
+		if p.TopQuoter != (leaderboardEntry{User: "<@8>", Count: 2}) {
+			t.Errorf("top quoter = %+v, want <@8> with 2", p.TopQuoter)
+		}
+
+		p, err = conn.getProfile(ctx, testGuild, "9")
+		if err != nil {
+			t.Fatalf("getProfile: %v", err)
+		}
+		if p.QuoteeRank != 0 || p.QuoterRank != 3 || p.First.ID != 0 || !p.BusiestMonth.IsZero() || p.TopQuoter.User != "" {
+			t.Errorf("profile of a quoter who was never quoted = %+v", p)
+		}
+	})
+}
 
-	insertQuote(t, conn, Quote{Quote: "user1 first", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "user1 second", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "user2 only", Quotee: "<@2>", Quoter: "<@1>", CreatedAt: time.Now()})
+func TestGetActivity(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		utc2 := time.FixedZone("UTC+2", 2*60*60)
+		for _, q := range []Quote{
+			{Quotee: "<@7>", CreatedAt: time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)},
+			{Quotee: "<@8>", CreatedAt: time.Date(2024, time.March, 10, 23, 59, 0, 0, time.UTC)},
+			// a Monday in UTC+2 that is still Sunday in UTC
+			{Quotee: "<@7>", CreatedAt: time.Date(2024, time.March, 4, 1, 0, 0, 123456789, utc2)},
+			{Quotee: "<@7>", CreatedAt: time.Date(2024, time.May, 20, 12, 0, 0, 0, time.UTC)},
+		} {
+			q.Quote, q.Quoter, q.GuildID = "q", "<@1>", testGuild
+			insertQuote(t, conn, q)
+		}
+		insertQuote(t, conn, Quote{Quote: "q", Quotee: "<@7>", Quoter: "<@1>", CreatedAt: time.Now(), GuildID: "other"})
+
+		tests := []struct {
+			quotee string
+			iv     statsInterval
+			want   string
+		}{
+			{"", statsWeek, "2024-02-26:1 2024-03-04:2 2024-05-20:1"},
+			{"", statsMonth, "2024-03-01:3 2024-05-01:1"},
+			{"7", statsWeek, "2024-02-26:1 2024-03-04:1 2024-05-20:1"},
+			{"9", statsMonth, ""},
+		}
+		for _, tt := range tests {
+			counts, err := conn.getActivity(ctx, testGuild, tt.quotee, tt.iv)
+			if err != nil {
+				t.Fatalf("getActivity: %v", err)
+			}
+			var got []string
+			for _, c := range counts {
+				got = append(got, fmt.Sprintf("%s:%d", c.Start.Format(time.DateOnly), c.Count))
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("%s activity of %q = %v, want %s", tt.iv, tt.quotee, got, tt.want)
+			}
+		}
+	})
+}
 
-	q, err := conn.getLatestUserQuote(ctx, "1")
-	if err != nil {
-		t.Fatalf("getLatestUserQuote: %v", err)
-	}
-	if q.Quote != "user1 second" {
-		t.Errorf("latest user quote = %q, want %q", q.Quote, "user1 second")
-	}
+func TestQuoteTags(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		for _, q := range []Quote{
+			{Quote: "funny work", Quotee: "<@7>", Tags: []string{"funny", "work"}},
+			{Quote: "funny", Quotee: "<@8>", Tags: []string{"funny"}},
+			{Quote: "untagged", Quotee: "<@7>"},
+		} {
+			q.Quoter, q.CreatedAt, q.GuildID = "<@1>", time.Now(), testGuild
+			insertQuote(t, conn, q)
+		}
+		insertQuote(t, conn, Quote{Quote: "elsewhere", Quotee: "<@7>", Quoter: "<@1>", CreatedAt: time.Now(), GuildID: "other", Tags: []string{"work"}})
+
+		tagList := func() string {
+			t.Helper()
+			tags, err := conn.listTags(ctx, testGuild)
+			if err != nil {
+				t.Fatalf("listTags: %v", err)
+			}
+			var got []string
+			for _, tag := range tags {
+				got = append(got, fmt.Sprintf("%s:%d", tag.Name, tag.Count))
+			}
+			return strings.Join(got, " ")
+		}
+		quoteTags := func(id int64) string {
+			t.Helper()
+			q, err := conn.getQuote(ctx, testGuild, id)
+			if err != nil {
+				t.Fatalf("getQuote: %v", err)
+			}
+			return strings.Join(q.Tags, ",")
+		}
+
+		if got := quoteTags(1); got != "funny,work" {
+			t.Errorf("tags of #1 = %q, want funny,work", got)
+		}
+		if got := quoteTags(3); got != "" {
+			t.Errorf("tags of #3 = %q, want none", got)
+		}
+		if got := tagList(); got != "funny:2 work:1" {
+			t.Errorf("listTags = %q", got)
+		}
+
+		for range 10 {
+			q, err := conn.getRandQuote(ctx, testGuild, "work")
+			if err != nil || q.ID != 1 {
+				t.Fatalf("getRandQuote tagged work = #%d, %v; want #1", q.ID, err)
+			}
+		}
+		if q, err := conn.getRandUserQuote(ctx, testGuild, "8", "funny"); err != nil || q.ID != 2 {
+			t.Errorf("getRandUserQuote tagged funny = #%d, %v; want #2", q.ID, err)
+		}
+		if _, err := conn.getRandUserQuote(ctx, testGuild, "8", "work"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("getRandUserQuote with no matching tag: err = %v, want sql.ErrNoRows", err)
+		}
+		results, err := conn.searchQuote(ctx, testGuild, "funny", searchByRelevance, "work")
+		if err != nil || len(results) != 1 || results[0].ID != 1 {
+			t.Errorf("searchQuote tagged work = %+v, %v; want only #1", results, err)
+		}
+
+		if err := conn.editQuote(ctx, testGuild, 1, quoteEdit{Tags: []string{"meta"}, SetTags: true}); err != nil {
+			t.Fatalf("editQuote: %v", err)
+		}
+		if got := quoteTags(1); got != "meta" {
+			t.Errorf("tags of #1 after editQuote = %q, want meta", got)
+		}
+		// work is no longer on any of the guild's quotes, though the other guild still uses it
+		if got := tagList(); got != "funny:1 meta:1" {
+			t.Errorf("listTags after editQuote = %q", got)
+		}
+		if err := conn.editQuote(ctx, testGuild, 99, quoteEdit{Tags: []string{"meta"}, SetTags: true}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("editQuote on a missing quote: err = %v, want sql.ErrNoRows", err)
+		}
+		if err := conn.editQuote(ctx, testGuild, 4, quoteEdit{Tags: []string{"meta"}, SetTags: true}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("editQuote on another guild's quote: err = %v, want sql.ErrNoRows", err)
+		}
+
+		if err := conn.deleteQuote(ctx, testGuild, 2); err != nil {
+			t.Fatalf("deleteQuote: %v", err)
+		}
+		if err := conn.editQuote(ctx, testGuild, 1, quoteEdit{SetTags: true}); err != nil {
+			t.Fatalf("editQuote: %v", err)
+		}
+		if got := tagList(); got != "" {
+			t.Errorf("listTags after removing every tag = %q, want none", got)
+		}
+		if q, err := conn.getRandQuote(ctx, "other", "work"); err != nil || q.ID != 4 {
+			t.Errorf("other guild's quote tagged work = #%d, %v; want #4", q.ID, err)
+		}
+	})
+}
 
-	// unknown user should return sql.ErrNoRows
-	_, err = conn.getLatestUserQuote(ctx, "999")
-	if err == nil {
-		t.Fatal("expected error for unknown user, got nil")
-	}
+func TestGuildIsolation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		const otherGuild = "200"
+
+		insertQuote(t, conn, Quote{Quote: "home world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "away world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: otherGuild})
+		insertQuote(t, conn, Quote{Quote: "away again", Quotee: "<@3>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: otherGuild})
+
+		count, err := conn.quoteCount(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 quote in home guild, got %d", count)
+		}
+
+		// the cache is per guild, so priming one guild must not leak into another
+		count, err = conn.quoteCount(ctx, otherGuild)
+		if err != nil {
+			t.Fatalf("quoteCount other guild: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 quotes in other guild, got %d", count)
+		}
+
+		q, err := conn.getLatestQuote(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("getLatestQuote: %v", err)
+		}
+		if q.Quote != "home world" || q.GuildID != testGuild {
+			t.Errorf("latest quote = %q in guild %q, want %q in %q", q.Quote, q.GuildID, "home world", testGuild)
+		}
+
+		results, err := conn.searchQuote(ctx, testGuild, "world", searchByRelevance, "")
+		if err != nil {
+			t.Fatalf("searchQuote: %v", err)
+		}
+		if len(results) != 1 {
+			t.Errorf("expected 1 search result in home guild, got %d", len(results))
+		}
+
+		if _, err := conn.getRandUserQuote(ctx, testGuild, "3", ""); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows for quotee from another guild, got %v", err)
+		}
+
+		lb, err := conn.getLeaderboard(ctx, testGuild, leaderboardQuery{})
+		if err != nil {
+			t.Fatalf("getLeaderboard: %v", err)
+		}
+		if formatLeaderboard(lb) != "`1:` <@1>: 1" {
+			t.Errorf("leaderboard = %q, want only the home guild quotee", lb)
+		}
+
+		quotes, err := conn.listQuotes(ctx, otherGuild)
+		if err != nil {
+			t.Fatalf("listQuotes: %v", err)
+		}
+		if len(quotes) != 2 || quotes[0].Quote != "away world" {
+			t.Errorf("listQuotes(other guild) = %+v, want its 2 quotes oldest first", quotes)
+		}
+
+		quotes, err = conn.listQuotes(ctx, "")
+		if err != nil {
+			t.Fatalf("listQuotes every guild: %v", err)
+		}
+		if len(quotes) != 3 {
+			t.Errorf("expected 3 quotes across every guild, got %d", len(quotes))
+		}
+	})
 }
 
-func TestSearchQuote(t *testing.T) {
+func TestQuoteSourceRoundTrip(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "from chat", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(),
+			GuildID: testGuild, ChannelID: "200", MessageID: "300"})
+
+		q, err := conn.getLatestQuote(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("getLatestQuote: %v", err)
+		}
+		if q.ChannelID != "200" || q.MessageID != "300" {
+			t.Errorf("source = %q/%q, want 200/300", q.ChannelID, q.MessageID)
+		}
+		if want := "https://discord.com/channels/" + testGuild + "/200/300"; q.JumpLink() != want {
+			t.Errorf("JumpLink = %q, want %q", q.JumpLink(), want)
+		}
+	})
+}
+
+func TestEditAndDeleteQuote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "typo'd", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "keeper", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+		latest, err := conn.getLatestQuote(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("getLatestQuote: %v", err)
+		}
+		first := latest.ID - 1
+
+		// prime the count cache so the delete has something to invalidate
+		if _, err := conn.quoteCount(ctx, testGuild); err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+
+		if err := conn.editQuote(ctx, testGuild, first, quoteEdit{Quote: "fixed"}); err != nil {
+			t.Fatalf("editQuote: %v", err)
+		}
+		q, err := conn.getQuote(ctx, testGuild, first)
+		if err != nil {
+			t.Fatalf("getQuote: %v", err)
+		}
+		if q.Quote != "fixed" {
+			t.Errorf("edited quote = %q, want %q", q.Quote, "fixed")
+		}
+
+		results, err := conn.searchQuote(ctx, testGuild, "fixed", searchByRelevance, "")
+		if err != nil {
+			t.Fatalf("searchQuote: %v", err)
+		}
+		if len(results) != 1 {
+			t.Errorf("expected edited text to be searchable, got %d results", len(results))
+		}
+
+		if err := conn.deleteQuote(ctx, testGuild, first); err != nil {
+			t.Fatalf("deleteQuote: %v", err)
+		}
+		if _, err := conn.getQuote(ctx, testGuild, first); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+		}
+
+		count, err := conn.quoteCount(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("quoteCount after delete: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 quote after delete, got %d", count)
+		}
+
+		results, err = conn.searchQuote(ctx, testGuild, "fixed", searchByRelevance, "")
+		if err != nil {
+			t.Fatalf("searchQuote after delete: %v", err)
+		}
+		if len(results) != 0 {
+			t.Errorf("expected deleted quote to leave the search index, got %d results", len(results))
+		}
+
+		// quotes can't be changed from another guild or once they are gone
+		if err := conn.editQuote(ctx, "200", latest.ID, quoteEdit{Quote: "hijacked"}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows editing from another guild, got %v", err)
+		}
+		if err := conn.deleteQuote(ctx, testGuild, first); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestEditQuoteAtomically(t *testing.T) {
 	conn := newTestDB(t)
 	ctx := context.Background()
+	insertQuote(t, conn, Quote{Quote: "tpyo", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild, Tags: []string{"old"}})
 
-	insertQuote(t, conn, Quote{Quote: "hello world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "goodbye world", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "nothing matches", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-
-	results, err := conn.searchQuote(ctx, "world")
+	if err := conn.editQuote(ctx, testGuild, 1, quoteEdit{Quote: "typo", Tags: []string{"new"}, SetTags: true}); err != nil {
+		t.Fatalf("editQuote: %v", err)
+	}
+	q, err := conn.getQuote(ctx, testGuild, 1)
 	if err != nil {
-		t.Fatalf("searchQuote: %v", err)
+		t.Fatalf("getQuote: %v", err)
 	}
-	if len(results) != 2 {
-		t.Errorf("expected 2 results, got %d", len(results))
+	if q.Quote != "typo" || !reflect.DeepEqual(q.Tags, []string{"new"}) {
+		t.Errorf("after edit = %q tagged %q, want typo tagged new", q.Quote, q.Tags)
 	}
 
-	// no match
-	results, err = conn.searchQuote(ctx, "zzznomatch")
-	if err != nil {
-		t.Fatalf("searchQuote no match: %v", err)
+	// a tag write that fails takes the new text with it
+	if _, err := conn.Conn.Exec(`DROP TABLE ` + quoteTagsTable(conn.Table)); err != nil {
+		t.Fatalf("drop tag links: %v", err)
+	}
+	if err := conn.editQuote(ctx, testGuild, 1, quoteEdit{Quote: "half done", Tags: []string{"other"}, SetTags: true}); err == nil {
+		t.Fatal("expected editQuote to fail without the tag links table")
+	}
+	var text string
+	if err := conn.Conn.QueryRow(`SELECT quote FROM quotes WHERE id = 1`).Scan(&text); err != nil {
+		t.Fatalf("read text: %v", err)
 	}
-	if len(results) != 0 {
-		t.Errorf("expected 0 results, got %d", len(results))
+	if text != "typo" {
+		t.Errorf("text after a failed edit = %q, want it unchanged", text)
 	}
 }
 
-func TestGetLeaderboard(t *testing.T) {
-	conn := newTestDB(t)
-	ctx := context.Background()
+func TestQuoteIDs(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		first, err := conn.createQuote(ctx, Quote{Quote: "one", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		if err != nil {
+			t.Fatalf("createQuote: %v", err)
+		}
+		second, err := conn.createQuote(ctx, Quote{Quote: "two", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		if err != nil {
+			t.Fatalf("createQuote: %v", err)
+		}
+		if second <= first {
+			t.Errorf("expected increasing IDs, got %d then %d", first, second)
+		}
+
+		q, err := conn.getQuote(ctx, testGuild, first)
+		if err != nil {
+			t.Fatalf("getQuote: %v", err)
+		}
+		if q.ID != first || q.Quote != "one" {
+			t.Errorf("getQuote(%d) = #%d %q, want #%d %q", first, q.ID, q.Quote, first, "one")
+		}
+
+		latest, err := conn.getLatestQuote(ctx, testGuild)
+		if err != nil {
+			t.Fatalf("getLatestQuote: %v", err)
+		}
+		if latest.ID != second {
+			t.Errorf("latest ID = %d, want %d", latest.ID, second)
+		}
+
+		// IDs are only meaningful within the guild that owns the quote
+		if _, err := conn.getQuote(ctx, "200", first); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected sql.ErrNoRows from another guild, got %v", err)
+		}
+	})
+}
 
-	insertQuote(t, conn, Quote{Quote: "a", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "b", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
-	insertQuote(t, conn, Quote{Quote: "c", Quotee: "<@2>", Quoter: "<@1>", CreatedAt: time.Now()})
+func TestGetDailyQuote(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		day := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+
+		if _, err := conn.getDailyQuote(ctx, testGuild, day); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows from an empty collection, got %v", err)
+		}
+
+		const total = 5
+		for x := 0; x < total; x++ {
+			insertQuote(t, conn, Quote{Quote: fmt.Sprintf("quote %d", x), Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		}
+		insertQuote(t, conn, Quote{Quote: "elsewhere", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: "200"})
+
+		first, err := conn.getDailyQuote(ctx, testGuild, day)
+		if err != nil {
+			t.Fatalf("getDailyQuote: %v", err)
+		}
+		again, err := conn.getDailyQuote(ctx, testGuild, day.Add(8*time.Hour))
+		if err != nil {
+			t.Fatalf("getDailyQuote again: %v", err)
+		}
+		if again.ID != first.ID {
+			t.Errorf("same day picked #%d then #%d", first.ID, again.ID)
+		}
+
+		// every quote gets a day before any quote repeats
+		seen := map[int64]bool{first.ID: true}
+		for d := 1; d < total; d++ {
+			q, err := conn.getDailyQuote(ctx, testGuild, day.AddDate(0, 0, d))
+			if err != nil {
+				t.Fatalf("getDailyQuote day %d: %v", d, err)
+			}
+			if q.GuildID != testGuild {
+				t.Errorf("day %d picked a quote from guild %s", d, q.GuildID)
+			}
+			if seen[q.ID] {
+				t.Errorf("day %d repeated #%d before the collection was exhausted", d, q.ID)
+			}
+			seen[q.ID] = true
+		}
+
+		if _, err := conn.getDailyQuote(ctx, testGuild, day.AddDate(0, 0, total)); err != nil {
+			t.Fatalf("getDailyQuote after a full cycle: %v", err)
+		}
+
+		// a deleted pick is replaced rather than returned
+		if err := conn.deleteQuote(ctx, testGuild, first.ID); err != nil {
+			t.Fatalf("deleteQuote: %v", err)
+		}
+		q, err := conn.getDailyQuote(ctx, testGuild, day)
+		if err != nil {
+			t.Fatalf("getDailyQuote after delete: %v", err)
+		}
+		if q.ID == first.ID {
+			t.Errorf("deleted quote #%d is still the quote of the day", q.ID)
+		}
+	})
+}
 
-	lb, err := conn.getLeaderboard(ctx)
-	if err != nil {
-		t.Fatalf("getLeaderboard: %v", err)
-	}
-	if lb == "" {
-		t.Error("expected non-empty leaderboard")
-	}
-	// user 1 has 2 quotes and should appear first
-	if lb[:5] != "`1:` " {
-		t.Errorf("leaderboard doesn't start with position 1: %q", lb[:10])
-	}
+func TestQuoteCountAllGuilds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+
+		insertQuote(t, conn, Quote{Quote: "home", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+		count, err := conn.quoteCount(ctx, "")
+		if err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 quote across guilds, got %d", count)
+		}
+
+		// adding to any guild must not leave the cached total stale
+		insertQuote(t, conn, Quote{Quote: "away", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: "200"})
+		count, err = conn.quoteCount(ctx, "")
+		if err != nil {
+			t.Fatalf("quoteCount: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 quotes across guilds, got %d", count)
+		}
+	})
 }
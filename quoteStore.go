@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// QuoteStore is the set of quote operations the handlers depend on. SQLConn backs it with SQLite or PostgreSQL
+// and memStore keeps everything in memory. Every read is scoped to a single guild's collection.
+type QuoteStore interface {
+	createQuote(ctx context.Context, quote Quote) (int64, error)
+	getQuote(ctx context.Context, guild string, id int64) (Quote, error)
+	editQuote(ctx context.Context, guild string, id int64, edit quoteEdit) error
+	deleteQuote(ctx context.Context, guild string, id int64) error
+	listTags(ctx context.Context, guild string) ([]tagCount, error)
+	getRandQuote(ctx context.Context, guild string, tag string) (Quote, error)
+	getRandUserQuote(ctx context.Context, guild string, quotee string, tag string) (Quote, error)
+	getLatestQuote(ctx context.Context, guild string) (Quote, error)
+	getLatestUserQuote(ctx context.Context, guild string, quotee string) (Quote, error)
+	searchQuote(ctx context.Context, guild string, s string, order searchOrder, tag string) ([]Quote, error)
+	searchCount(ctx context.Context, guild string, s string, tag string) (int, error)
+	getLeaderboard(ctx context.Context, guild string, q leaderboardQuery) ([]leaderboardEntry, error)
+	getLeaderboardRank(ctx context.Context, guild string, q leaderboardQuery, user string) (leaderboardEntry, int, error)
+	getProfile(ctx context.Context, guild string, user string) (userProfile, error)
+	getActivity(ctx context.Context, guild string, quotee string, iv statsInterval) ([]activityCount, error)
+	quoteCount(ctx context.Context, guild string) (int, error)
+	listQuotes(ctx context.Context, guild string) ([]Quote, error)
+	getDailyQuote(ctx context.Context, guild string, day time.Time) (Quote, error)
+	Close() error
+}
+
+var (
+	_ QuoteStore = (*SQLConn)(nil)
+	_ QuoteStore = (*memStore)(nil)
+)
+
+// openStore opens the quote backend selected by DB_DRIVER, defaulting to SQLite
+func openStore() (QuoteStore, error) {
+	switch d := dialect(os.Getenv("DB_DRIVER")); d {
+	case "", dialectSQLite:
+		return newSQLConn()
+	case dialectPostgres:
+		return newPGConn()
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q", d)
+	}
+}
+
+// storeTarget returns the table and dialect of the configured backend, for writing SQL that replays into it
+func storeTarget() (string, dialect) {
+	if d := dialect(os.Getenv("DB_DRIVER")); d == dialectPostgres {
+		return os.Getenv("POSTGRES_TABLE_NAME"), d
+	}
+	return os.Getenv("SQLITE_TABLE_NAME"), dialectSQLite
+}
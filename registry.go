@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// subcommand is a /quote subcommand: the definition registered with Discord and the handler its interactions are
+// dispatched to
+type subcommand interface {
+	definition() *discordgo.ApplicationCommandOption
+	run(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption)
+	check() error
+}
+
+// typedSubcommand declares a subcommand once. Its handler receives the options as a T, a struct whose fields are
+// tagged with the name of the option they are filled from. Optional options that were left out keep their zero value.
+type typedSubcommand[T any] struct {
+	Name        string
+	Description string
+	Options     []*discordgo.ApplicationCommandOption
+	Handler     func(c *HandlerContext, i *discordgo.InteractionCreate, opts T)
+}
+
+// noOptions is the options struct of subcommands that take none
+type noOptions struct{}
+
+func (s typedSubcommand[T]) definition() *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Name:        s.Name,
+		Description: s.Description,
+		Type:        discordgo.ApplicationCommandOptionSubCommand,
+		Options:     s.Options,
+	}
+}
+
+func (s typedSubcommand[T]) run(c *HandlerContext, i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption) {
+	var opts T
+	if err := bindOptions(i, o, &opts); err != nil {
+		sendErr(c.Discord, i, err)
+		return
+	}
+	s.Handler(c, i, opts)
+}
+
+// check reports an options field that no declared option fills, or fills with the wrong type, and a declared option
+// that no field receives
+func (s typedSubcommand[T]) check() error {
+	declared := make(map[string]discordgo.ApplicationCommandOptionType, len(s.Options))
+	for _, o := range s.Options {
+		declared[o.Name] = o.Type
+	}
+
+	bound := make(map[string]bool)
+	t := reflect.TypeFor[T]()
+	for x := 0; x < t.NumField(); x++ {
+		f := t.Field(x)
+		name, ok := f.Tag.Lookup("option")
+		if !ok {
+			continue
+		}
+		typ, ok := declared[name]
+		if !ok {
+			return fmt.Errorf("%s: field %s is bound to undeclared option %q", s.Name, f.Name, name)
+		}
+		if want, ok := optionFieldType(f.Type); !ok || want != typ {
+			return fmt.Errorf("%s: field %s of type %s cannot hold option %q of type %s", s.Name, f.Name, f.Type, name, typ)
+		}
+		bound[name] = true
+	}
+
+	for _, o := range s.Options {
+		if !bound[o.Name] {
+			return fmt.Errorf("%s: option %q is not bound to a field", s.Name, o.Name)
+		}
+	}
+	return nil
+}
+
+var (
+	userType       = reflect.TypeFor[*discordgo.User]()
+	attachmentType = reflect.TypeFor[*discordgo.MessageAttachment]()
+)
+
+// optionFieldType returns the option type a field of type t holds. Named string types such as exportFormat hold
+// string options, so choices can be bound straight to the type that handles them.
+func optionFieldType(t reflect.Type) (discordgo.ApplicationCommandOptionType, bool) {
+	switch {
+	case t == userType:
+		return discordgo.ApplicationCommandOptionUser, true
+	case t == attachmentType:
+		return discordgo.ApplicationCommandOptionAttachment, true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return discordgo.ApplicationCommandOptionString, true
+	case reflect.Int64:
+		return discordgo.ApplicationCommandOptionInteger, true
+	case reflect.Float64:
+		return discordgo.ApplicationCommandOptionNumber, true
+	case reflect.Bool:
+		return discordgo.ApplicationCommandOptionBoolean, true
+	default:
+		return 0, false
+	}
+}
+
+// bindOptions fills the fields of the struct dst points to from the options named by their option tags, resolving
+// users and attachments from the interaction
+func bindOptions(i *discordgo.InteractionCreate, o []*discordgo.ApplicationCommandInteractionDataOption, dst any) error {
+	byName := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(o))
+	for _, opt := range o {
+		byName[opt.Name] = opt
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	for x := 0; x < v.NumField(); x++ {
+		f := v.Type().Field(x)
+		name, ok := f.Tag.Lookup("option")
+		if !ok {
+			continue
+		}
+		opt, ok := byName[name]
+		if !ok {
+			continue
+		}
+
+		if want, ok := optionFieldType(f.Type); !ok || want != opt.Type {
+			return fmt.Errorf("option %q of type %s cannot be bound to %s", name, opt.Type, f.Type)
+		}
+		value, err := optionValue(i, opt)
+		if err != nil {
+			return err
+		}
+		v.Field(x).Set(value.Convert(f.Type))
+	}
+	return nil
+}
+
+// optionValue returns the value of an option as the type optionFieldType maps its option type to
+func optionValue(i *discordgo.InteractionCreate, o *discordgo.ApplicationCommandInteractionDataOption) (reflect.Value, error) {
+	switch o.Type {
+	case discordgo.ApplicationCommandOptionString:
+		return reflect.ValueOf(o.StringValue()), nil
+	case discordgo.ApplicationCommandOptionInteger:
+		return reflect.ValueOf(o.IntValue()), nil
+	case discordgo.ApplicationCommandOptionNumber:
+		return reflect.ValueOf(o.FloatValue()), nil
+	case discordgo.ApplicationCommandOptionBoolean:
+		return reflect.ValueOf(o.BoolValue()), nil
+	case discordgo.ApplicationCommandOptionUser:
+		return reflect.ValueOf(optionUser(i, o)), nil
+	case discordgo.ApplicationCommandOptionAttachment:
+		id, _ := o.Value.(string)
+		if resolved := i.ApplicationCommandData().Resolved; resolved != nil {
+			if a, ok := resolved.Attachments[id]; ok {
+				return reflect.ValueOf(a), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("attachment %s was not resolved", id)
+	default:
+		return reflect.Value{}, fmt.Errorf("option %q has unsupported type %s", o.Name, o.Type)
+	}
+}
+
+// subcommandOptions returns the definitions of subcommands, for registering the command they belong to
+func subcommandOptions(subs []subcommand) []*discordgo.ApplicationCommandOption {
+	opts := make([]*discordgo.ApplicationCommandOption, 0, len(subs))
+	for _, s := range subs {
+		opts = append(opts, s.definition())
+	}
+	return opts
+}
+
+// subcommandsByName indexes subcommands for dispatch
+func subcommandsByName(subs []subcommand) map[string]subcommand {
+	m := make(map[string]subcommand, len(subs))
+	for _, s := range subs {
+		m[s.definition().Name] = s
+	}
+	return m
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestSubcommandsBindTheirOptions(t *testing.T) {
+	for _, s := range quoteSubcommands {
+		if err := s.check(); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(quoteHandler) != len(quoteSubcommands) {
+		t.Errorf("%d subcommands dispatched, %d declared: names must be unique", len(quoteHandler), len(quoteSubcommands))
+	}
+}
+
+type boundOptions struct {
+	Text     string                       `option:"text"`
+	Count    int64                        `option:"count"`
+	Ratio    float64                      `option:"ratio"`
+	Public   bool                         `option:"public"`
+	Format   exportFormat                 `option:"format"`
+	Who      *discordgo.User              `option:"who"`
+	File     *discordgo.MessageAttachment `option:"file"`
+	Optional *discordgo.User              `option:"optional"`
+	Ignored  string
+}
+
+func TestBindOptions(t *testing.T) {
+	i := quoteInteraction(testUser, "bind",
+		// deliberately not in declaration order
+		option("file", discordgo.ApplicationCommandOptionAttachment, "9"),
+		option("who", discordgo.ApplicationCommandOptionUser, testOther),
+		option("format", discordgo.ApplicationCommandOptionString, "csv"),
+		option("public", discordgo.ApplicationCommandOptionBoolean, true),
+		option("ratio", discordgo.ApplicationCommandOptionNumber, 0.5),
+		option("count", discordgo.ApplicationCommandOptionInteger, float64(42)),
+		option("text", discordgo.ApplicationCommandOptionString, "hello"),
+	)
+	data := i.ApplicationCommandData()
+	data.Resolved.Attachments = map[string]*discordgo.MessageAttachment{"9": {ID: "9", Filename: "quotes.csv"}}
+	i.Data = data
+
+	var got boundOptions
+	if err := bindOptions(i, data.Options[0].Options, &got); err != nil {
+		t.Fatalf("bindOptions: %v", err)
+	}
+	if got.Text != "hello" || got.Count != 42 || got.Ratio != 0.5 || !got.Public || got.Format != formatCSV {
+		t.Errorf("scalars = %+v", got)
+	}
+	if got.Who == nil || got.Who.ID != testOther || got.Who.Username == "" {
+		t.Errorf("user = %+v, want the resolved user", got.Who)
+	}
+	if got.File == nil || got.File.Filename != "quotes.csv" {
+		t.Errorf("file = %+v", got.File)
+	}
+	if got.Optional != nil {
+		t.Errorf("omitted option = %+v, want nil", got.Optional)
+	}
+}
+
+func TestBindOptionsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  *discordgo.ApplicationCommandInteractionDataOption
+		want string
+	}{
+		{"wrong type", option("text", discordgo.ApplicationCommandOptionInteger, float64(1)), `option "text" of type Integer cannot be bound to string`},
+		{"unresolved attachment", option("file", discordgo.ApplicationCommandOptionAttachment, "9"), "attachment 9 was not resolved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := quoteInteraction(testUser, "bind", tt.opt)
+			var got boundOptions
+			err := bindOptions(i, i.ApplicationCommandData().Options[0].Options, &got)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubcommandCheck(t *testing.T) {
+	text := &discordgo.ApplicationCommandOption{Name: "text", Type: discordgo.ApplicationCommandOptionString}
+	count := &discordgo.ApplicationCommandOption{Name: "count", Type: discordgo.ApplicationCommandOptionInteger}
+
+	type textOptions struct {
+		Text string `option:"text"`
+	}
+	tests := []struct {
+		name string
+		sub  subcommand
+		want string
+	}{
+		{"matching", typedSubcommand[textOptions]{Name: "ok", Options: []*discordgo.ApplicationCommandOption{text}}, ""},
+		{"undeclared", typedSubcommand[textOptions]{Name: "sub"}, `sub: field Text is bound to undeclared option "text"`},
+		{"wrong type", typedSubcommand[idOptions]{Name: "sub", Options: []*discordgo.ApplicationCommandOption{{Name: "id", Type: discordgo.ApplicationCommandOptionString}}}, "cannot hold option"},
+		{"unbound", typedSubcommand[textOptions]{Name: "sub", Options: []*discordgo.ApplicationCommandOption{text, count}}, `sub: option "count" is not bound to a field`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sub.check()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("check: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Responder is the part of a Discord session that answers interactions. *discordgo.Session implements it, and tests
+// substitute a fake that records every reply.
+type Responder interface {
+	InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error
+	InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error)
+	InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error
+	FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error)
+}
+
+var _ Responder = (*discordgo.Session)(nil)
+
+// deferAfter is how long a handler may take before its interaction is acknowledged with a deferred response.
+// Discord rejects a first response that arrives more than 3 seconds after the interaction.
+const deferAfter = 2 * time.Second
+
+// replyState is how far an interaction has been answered
+type replyState int
+
+const (
+	replyPending replyState = iota
+	replyDeferred
+	replySent
+)
+
+// pendingReply tracks the response to one interaction so the send helpers know whether to respond, edit the deferred
+// response or follow up
+type pendingReply struct {
+	mu        sync.Mutex
+	state     replyState
+	ephemeral bool
+	timer     *time.Timer
+	// claimed is set, under replies.mu, once the handler has returned and the reply is no longer tracked
+	claimed bool
+}
+
+// replies holds the pending reply of every interaction being handled, keyed by interaction ID
+var replies = struct {
+	mu sync.Mutex
+	m  map[string]*pendingReply
+}{m: make(map[string]*pendingReply)}
+
+// replyFor returns the tracked reply of an interaction, creating it if create is set
+func replyFor(i *discordgo.InteractionCreate, create bool) *pendingReply {
+	replies.mu.Lock()
+	defer replies.mu.Unlock()
+
+	r, ok := replies.m[i.ID]
+	if !ok && create {
+		r = &pendingReply{}
+		replies.m[i.ID] = r
+	}
+	return r
+}
+
+// trackReply starts tracking an interaction's reply and defers it if the handler has not replied after the given
+// delay. The returned function stops tracking once the handler returns.
+func trackReply(s Responder, i *discordgo.InteractionCreate, after time.Duration) func() {
+	r := replyFor(i, true)
+	r.mu.Lock()
+	r.timer = time.AfterFunc(after, func() { r.deferLate(s, i) })
+	r.mu.Unlock()
+
+	return func() {
+		// claim and forget the reply together, so a timer firing now sees the claim and can't defer a handled
+		// interaction
+		replies.mu.Lock()
+		r.claimed = true
+		delete(replies.m, i.ID)
+		replies.mu.Unlock()
+
+		r.mu.Lock()
+		r.timer.Stop()
+		r.mu.Unlock()
+	}
+}
+
+// deferLate is run by trackReply's timer. It defers the reply unless the handler has already returned.
+func (r *pendingReply) deferLate(s Responder, i *discordgo.InteractionCreate) {
+	replies.mu.Lock()
+	claimed := r.claimed
+	replies.mu.Unlock()
+	if claimed {
+		return
+	}
+
+	if err := r.deferAs(s, i, false); err != nil {
+		slog.ErrorContext(withInteraction(context.Background(), i), "error deferring response", "err", err)
+	}
+}
+
+// deferReply acknowledges an interaction so the handler can take up to 15 minutes to reply. Handlers whose reply is
+// ephemeral should defer as ephemeral, because the visibility of a deferred response cannot change afterwards. It
+// does nothing if the interaction has already been answered.
+func deferReply(s Responder, i *discordgo.InteractionCreate, ephemeral bool) error {
+	return replyFor(i, true).deferAs(s, i, ephemeral)
+}
+
+// deferAs sends the deferred response of deferReply for a tracked reply
+func (r *pendingReply) deferAs(s Responder, i *discordgo.InteractionCreate, ephemeral bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state != replyPending {
+		return nil
+	}
+
+	resp := &discordgo.InteractionResponse{Type: discordgo.InteractionResponseDeferredChannelMessageWithSource}
+	if i.Type == discordgo.InteractionMessageComponent {
+		// components keep showing the message they are attached to until it is edited
+		resp.Type = discordgo.InteractionResponseDeferredMessageUpdate
+	} else if ephemeral {
+		resp.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+
+	if err := s.InteractionRespond(i.Interaction, resp); err != nil {
+		return err
+	}
+	r.state = replyDeferred
+	r.ephemeral = ephemeral
+	return nil
+}
+
+// respond sends resp as the reply to an interaction whether or not it was deferred, so every send helper works the
+// same in both modes
+func respond(s Responder, i *discordgo.InteractionCreate, resp *discordgo.InteractionResponse) {
+	var err error
+	if r := replyFor(i, false); r == nil {
+		err = s.InteractionRespond(i.Interaction, resp)
+	} else {
+		r.mu.Lock()
+		switch r.state {
+		case replyPending:
+			err = s.InteractionRespond(i.Interaction, resp)
+		case replyDeferred:
+			err = finishDeferred(s, i, r.ephemeral, resp)
+		default:
+			_, err = s.FollowupMessageCreate(i.Interaction, true, webhookParams(resp.Data))
+		}
+		r.state = replySent
+		r.mu.Unlock()
+	}
+
+	if err != nil {
+		slog.ErrorContext(withInteraction(context.Background(), i), "error responding to interaction", "err", err)
+	}
+}
+
+// finishDeferred completes a deferred interaction with resp. It edits the deferred response when that shows resp as
+// intended, and otherwise sends resp as a follow-up, removing the placeholder a command shows while it is deferred.
+func finishDeferred(s Responder, i *discordgo.InteractionCreate, deferredEphemeral bool, resp *discordgo.InteractionResponse) error {
+	data := resp.Data
+	if data == nil {
+		data = &discordgo.InteractionResponseData{}
+	}
+	ephemeral := data.Flags&discordgo.MessageFlagsEphemeral != 0
+
+	if i.Type == discordgo.InteractionMessageComponent {
+		if resp.Type == discordgo.InteractionResponseUpdateMessage {
+			_, err := s.InteractionResponseEdit(i.Interaction, webhookEdit(data))
+			return err
+		}
+		_, err := s.FollowupMessageCreate(i.Interaction, true, webhookParams(data))
+		return err
+	}
+
+	if ephemeral == deferredEphemeral {
+		_, err := s.InteractionResponseEdit(i.Interaction, webhookEdit(data))
+		return err
+	}
+	if _, err := s.FollowupMessageCreate(i.Interaction, true, webhookParams(data)); err != nil {
+		return err
+	}
+	return s.InteractionResponseDelete(i.Interaction)
+}
+
+// webhookEdit converts response data to an edit of the original response
+func webhookEdit(d *discordgo.InteractionResponseData) *discordgo.WebhookEdit {
+	// nil slices would be sent as null, so only replace what the response sets
+	edit := &discordgo.WebhookEdit{Content: &d.Content, Files: d.Files}
+	if d.Embeds != nil {
+		edit.Embeds = &d.Embeds
+	}
+	if d.Components != nil {
+		edit.Components = &d.Components
+	}
+	return edit
+}
+
+// webhookParams converts response data to a follow-up message
+func webhookParams(d *discordgo.InteractionResponseData) *discordgo.WebhookParams {
+	return &discordgo.WebhookParams{
+		Content:    d.Content,
+		Embeds:     d.Embeds,
+		Components: d.Components,
+		Files:      d.Files,
+		Flags:      d.Flags,
+	}
+}
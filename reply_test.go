@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testInteraction builds an interaction of the given type with a unique ID
+func testInteraction(t *testing.T, typ discordgo.InteractionType) *discordgo.InteractionCreate {
+	i := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		ID:      strings.ReplaceAll(t.Name(), "/", "-"),
+		AppID:   "app",
+		Token:   "token",
+		Type:    typ,
+		GuildID: testGuild,
+	}}
+	switch typ {
+	case discordgo.InteractionApplicationCommand:
+		i.Data = discordgo.ApplicationCommandInteractionData{Name: "quote"}
+	case discordgo.InteractionMessageComponent:
+		i.Data = discordgo.MessageComponentInteractionData{CustomID: searchButtonID("1", 1)}
+	}
+	return i
+}
+
+var (
+	respondMessage        = fmt.Sprintf("respond type=%d", discordgo.InteractionResponseChannelMessageWithSource)
+	respondDeferred       = fmt.Sprintf("respond type=%d", discordgo.InteractionResponseDeferredChannelMessageWithSource)
+	respondDeferredUpdate = fmt.Sprintf("respond type=%d", discordgo.InteractionResponseDeferredMessageUpdate)
+)
+
+func TestReplyModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   discordgo.InteractionType
+		delay time.Duration
+		setup func(s Responder, i *discordgo.InteractionCreate) error
+		send  func(s Responder, i *discordgo.InteractionCreate)
+		want  []string
+	}{
+		{
+			name:  "fast reply responds directly",
+			typ:   discordgo.InteractionApplicationCommand,
+			delay: time.Hour,
+			send:  func(s Responder, i *discordgo.InteractionCreate) { sendMsg(s, i, "hi") },
+			want:  []string{respondMessage},
+		},
+		{
+			name:  "slow reply edits the deferred response",
+			typ:   discordgo.InteractionApplicationCommand,
+			delay: time.Millisecond,
+			send:  func(s Responder, i *discordgo.InteractionCreate) { sendEmbed(s, i, nil) },
+			want:  []string{respondDeferred, "edit"},
+		},
+		{
+			name:  "slow error follows up privately",
+			typ:   discordgo.InteractionApplicationCommand,
+			delay: time.Millisecond,
+			send:  func(s Responder, i *discordgo.InteractionCreate) { sendErr(s, i, errors.New("boom")) },
+			want:  []string{respondDeferred, "followup", "delete"},
+		},
+		{
+			name:  "explicit ephemeral deferral edits",
+			typ:   discordgo.InteractionApplicationCommand,
+			delay: time.Hour,
+			setup: func(s Responder, i *discordgo.InteractionCreate) error { return deferReply(s, i, true) },
+			send:  func(s Responder, i *discordgo.InteractionCreate) { sendEphemeral(s, i, "done") },
+			want:  []string{respondDeferred, "edit"},
+		},
+		{
+			name:  "slow component edits its message",
+			typ:   discordgo.InteractionMessageComponent,
+			delay: time.Millisecond,
+			send: func(s Responder, i *discordgo.InteractionCreate) {
+				updateMsg(s, i, &discordgo.InteractionResponseData{Content: "page 2"})
+			},
+			want: []string{respondDeferredUpdate, "edit"},
+		},
+		{
+			name:  "second reply follows up",
+			typ:   discordgo.InteractionApplicationCommand,
+			delay: time.Hour,
+			send: func(s Responder, i *discordgo.InteractionCreate) {
+				sendMsg(s, i, "one")
+				sendMsg(s, i, "two")
+			},
+			want: []string{respondMessage, "followup"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeResponder{}
+			i := testInteraction(t, tt.typ)
+
+			done := trackReply(s, i, tt.delay)
+			if tt.setup != nil {
+				if err := tt.setup(s, i); err != nil {
+					t.Fatalf("setup: %v", err)
+				}
+			}
+			if tt.delay < time.Second {
+				// wait for the deferral to be sent
+				deadline := time.Now().Add(5 * time.Second)
+				for len(s.methods()) == 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			tt.send(s, i)
+			done()
+
+			got := s.methods()
+			if len(got) != len(tt.want) {
+				t.Fatalf("calls = %q, want %d calls", got, len(tt.want))
+			}
+			for x, want := range tt.want {
+				if got[x] != want {
+					t.Errorf("call %d = %q, want %q", x, got[x], want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrackReplyForgetsInteraction(t *testing.T) {
+	s := &fakeResponder{}
+	i := testInteraction(t, discordgo.InteractionApplicationCommand)
+
+	done := trackReply(s, i, time.Hour)
+	if replyFor(i, false) == nil {
+		t.Fatal("expected the interaction to be tracked")
+	}
+	done()
+	if replyFor(i, false) != nil {
+		t.Error("expected the interaction to be forgotten once handled")
+	}
+}
+
+func TestLateDeferralAfterHandlerReturns(t *testing.T) {
+	s := &fakeResponder{}
+	i := testInteraction(t, discordgo.InteractionApplicationCommand)
+
+	done := trackReply(s, i, time.Hour)
+	r := replyFor(i, false)
+	done()
+	// the timer firing after the handler returned, as if Stop came too late
+	r.deferLate(s, i)
+
+	if replyFor(i, false) != nil {
+		t.Error("expected the late timer not to track the interaction again")
+	}
+	if got := s.methods(); len(got) != 0 {
+		t.Errorf("calls = %q, want none for a handled interaction", got)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// fakeCall is one request a handler made through a Responder. Data holds what the request would show, whichever
+// method sent it.
+type fakeCall struct {
+	Method string
+	Type   discordgo.InteractionResponseType
+	Data   *discordgo.InteractionResponseData
+}
+
+// String renders the call as the method and, for responses, the response type
+func (c fakeCall) String() string {
+	if c.Method == "respond" {
+		return fmt.Sprintf("respond type=%d", c.Type)
+	}
+	return c.Method
+}
+
+// fakeResponder is a Responder that records every call instead of talking to Discord
+type fakeResponder struct {
+	mu    sync.Mutex
+	calls []fakeCall
+}
+
+func (f *fakeResponder) record(c fakeCall) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, c)
+}
+
+func (f *fakeResponder) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, options ...discordgo.RequestOption) error {
+	f.record(fakeCall{Method: "respond", Type: resp.Type, Data: resp.Data})
+	return nil
+}
+
+func (f *fakeResponder) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	data := &discordgo.InteractionResponseData{Files: newresp.Files}
+	if newresp.Content != nil {
+		data.Content = *newresp.Content
+	}
+	if newresp.Embeds != nil {
+		data.Embeds = *newresp.Embeds
+	}
+	if newresp.Components != nil {
+		data.Components = *newresp.Components
+	}
+	f.record(fakeCall{Method: "edit", Data: data})
+	return &discordgo.Message{}, nil
+}
+
+func (f *fakeResponder) InteractionResponseDelete(interaction *discordgo.Interaction, options ...discordgo.RequestOption) error {
+	f.record(fakeCall{Method: "delete"})
+	return nil
+}
+
+func (f *fakeResponder) FollowupMessageCreate(interaction *discordgo.Interaction, wait bool, data *discordgo.WebhookParams, options ...discordgo.RequestOption) (*discordgo.Message, error) {
+	f.record(fakeCall{Method: "followup", Data: &discordgo.InteractionResponseData{
+		Content:    data.Content,
+		Embeds:     data.Embeds,
+		Components: data.Components,
+		Files:      data.Files,
+		Flags:      data.Flags,
+	}})
+	return &discordgo.Message{}, nil
+}
+
+// methods returns every recorded call rendered with String
+func (f *fakeResponder) methods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	methods := make([]string, 0, len(f.calls))
+	for _, c := range f.calls {
+		methods = append(methods, c.String())
+	}
+	return methods
+}
+
+// reply returns what the last call showed the user, skipping deferrals and deletions
+func (f *fakeResponder) reply(t *testing.T) *discordgo.InteractionResponseData {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for x := len(f.calls) - 1; x >= 0; x-- {
+		if c := f.calls[x]; c.Data != nil && c.Method != "delete" &&
+			c.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource &&
+			c.Type != discordgo.InteractionResponseDeferredMessageUpdate {
+			return c.Data
+		}
+	}
+	t.Fatalf("no reply recorded, calls: %v", f.calls)
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// searchOrder is how /quote search ranks its results
+type searchOrder string
+
+const (
+	searchByRelevance searchOrder = "relevance"
+	searchByDate      searchOrder = "date"
+)
+
+// searchTerm is a single word or phrase of a search query
+type searchTerm struct {
+	Text   string
+	Phrase bool
+	Prefix bool
+	Not    bool
+}
+
+// searchQuery is a parsed /quote search query in disjunctive form: a quote matches when every term of any one
+// group matches it.
+type searchQuery [][]searchTerm
+
+// parseSearchQuery parses user input into a searchQuery. It understands "quoted phrases", prefix* matching and
+// the AND, OR and NOT operators; adjacent terms are implicitly ANDed. Anything else is treated as plain words,
+// so no input can produce an invalid full-text query.
+func parseSearchQuery(s string) searchQuery {
+	var query searchQuery
+	var group []searchTerm
+	not := false
+
+	endGroup := func() {
+		// a group with only negated terms has nothing to match against
+		for _, term := range group {
+			if !term.Not {
+				query = append(query, group)
+				break
+			}
+		}
+		group = nil
+	}
+
+	for _, tok := range tokenizeSearch(s) {
+		switch {
+		case tok == "OR":
+			endGroup()
+			not = false
+		case tok == "AND":
+			// implicit between terms already
+		case tok == "NOT":
+			not = true
+		default:
+			// a quoted phrase, or a word such as "don't" that the tokenizer splits into several, is matched as a phrase
+			words := strings.FieldsFunc(tok, isSearchSeparator)
+			if len(words) > 0 {
+				group = append(group, searchTerm{
+					Text:   strings.Join(words, " "),
+					Phrase: len(words) > 1,
+					Prefix: !strings.HasPrefix(tok, `"`) && strings.HasSuffix(tok, "*"),
+					Not:    not,
+				})
+			}
+			not = false
+		}
+	}
+	endGroup()
+
+	return query
+}
+
+// tokenizeSearch splits s on whitespace, keeping "quoted phrases" together including their opening quote
+func tokenizeSearch(s string) []string {
+	var tokens []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				tokens = append(tokens, s)
+				break
+			}
+			tokens = append(tokens, s[:end+1])
+			s = s[end+2:]
+			continue
+		}
+
+		end := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		if end < 0 {
+			end = len(s)
+		}
+		tokens = append(tokens, s[:end])
+		s = s[end:]
+	}
+	return tokens
+}
+
+// isSearchSeparator reports whether r splits words, matching the unicode61 tokenizer closely enough that
+// every word we emit is a single FTS5 token
+func isSearchSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// fts5 renders the query in SQLite FTS5 syntax. Every word is double quoted so user input can never be
+// interpreted as FTS5 syntax of its own.
+func (q searchQuery) fts5() string {
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		var positive, negative []string
+		for _, term := range group {
+			s := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+			if term.Prefix {
+				s += "*"
+			}
+			if term.Not {
+				negative = append(negative, s)
+			} else {
+				positive = append(positive, s)
+			}
+		}
+
+		expr := strings.Join(positive, " AND ")
+		for _, s := range negative {
+			expr += " NOT " + s
+		}
+		groups = append(groups, "("+expr+")")
+	}
+	return strings.Join(groups, " OR ")
+}
+
+// websearch renders the query for PostgreSQL's websearch_to_tsquery, which has no prefix operator, so prefix
+// terms fall back to matching the stemmed word.
+func (q searchQuery) websearch() string {
+	groups := make([]string, 0, len(q))
+	for _, group := range q {
+		terms := make([]string, 0, len(group))
+		for _, term := range group {
+			s := term.Text
+			if term.Phrase {
+				s = fmt.Sprintf("%q", s)
+			}
+			if term.Not {
+				s = "-" + s
+			}
+			terms = append(terms, s)
+		}
+		groups = append(groups, strings.Join(terms, " "))
+	}
+	return strings.Join(groups, " or ")
+}
+
+// score returns how many terms of the best matching group appear in text, or 0 if no group matches. It is a
+// plain case-insensitive word match without stemming, used where no full-text index is available.
+func (q searchQuery) score(text string) int {
+	lower := strings.ToLower(text)
+	words := strings.FieldsFunc(lower, isSearchSeparator)
+	normalized := " " + strings.Join(words, " ") + " "
+
+	best := 0
+	for _, group := range q {
+		hits := 0
+		matched := true
+		for _, term := range group {
+			t := strings.ToLower(term.Text)
+			var found bool
+			if term.Prefix {
+				found = strings.Contains(normalized, " "+t)
+			} else {
+				found = strings.Contains(normalized, " "+t+" ")
+			}
+			if found == term.Not {
+				matched = false
+				break
+			}
+			if found {
+				hits += strings.Count(normalized, " "+t)
+			}
+		}
+		if matched && hits > best {
+			best = hits
+		}
+	}
+	return best
+}
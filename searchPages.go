@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	searchPageSize = 5
+	// searchPageTTL matches how long Discord keeps an interaction token valid
+	searchPageTTL = 15 * time.Minute
+	// searchComponentID prefixes the custom ID of every search paging button
+	searchComponentID = "search"
+	// searchesKept is how many searches the cache holds before dropping the oldest, each with up to searchLimit quotes
+	searchesKept = 256
+)
+
+// searchResults is one /quote search kept in memory so paging never goes back to the database
+type searchResults struct {
+	Term   string
+	Quotes []Quote
+	// Total counts every match, including any past the searchLimit held in Quotes
+	Total   int
+	Expires time.Time
+}
+
+// pages returns the number of pages needed to show every result
+func (r *searchResults) pages() int {
+	return max(1, (len(r.Quotes)+searchPageSize-1)/searchPageSize)
+}
+
+// SearchCache holds recent search results keyed by the ID of the interaction that ran the search
+type SearchCache struct {
+	mu      sync.Mutex
+	results map[string]*searchResults
+}
+
+// newSearchCache creates an empty search cache
+func newSearchCache() *SearchCache {
+	return &SearchCache{results: make(map[string]*searchResults)}
+}
+
+// put stores results under key and drops any expired searches, and the oldest search if the cache is still full
+func (c *SearchCache) put(key string, r *searchResults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var oldest string
+	for k, v := range c.results {
+		if now.After(v.Expires) {
+			delete(c.results, k)
+		} else if oldest == "" || v.Expires.Before(c.results[oldest].Expires) {
+			oldest = k
+		}
+	}
+	if _, ok := c.results[key]; !ok && len(c.results) >= searchesKept {
+		delete(c.results, oldest)
+	}
+	r.Expires = now.Add(searchPageTTL)
+	c.results[key] = r
+}
+
+// get returns the results stored under key if they have not expired
+func (c *SearchCache) get(key string) (*searchResults, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.results[key]
+	if !ok || time.Now().After(r.Expires) {
+		return nil, false
+	}
+	return r, true
+}
+
+// searchButtonID builds the custom ID of a button that shows page of the search stored under key
+func searchButtonID(key string, page int) string {
+	return fmt.Sprintf("%s:%s:%d", searchComponentID, key, page)
+}
+
+// parseSearchButtonID splits a custom ID built by searchButtonID into its key and page
+func parseSearchButtonID(id string) (string, int, error) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 3 || parts[0] != searchComponentID {
+		return "", 0, fmt.Errorf("malformed search button ID: %s", id)
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed search button page: %w", err)
+	}
+	return parts[1], page, nil
+}
+
+// searchPage renders one page of results as embeds with Previous and Next buttons. The page is clamped to the
+// available range.
+func searchPage(key string, r *searchResults, page int) *discordgo.InteractionResponseData {
+	pages := r.pages()
+	page = min(max(page, 0), pages-1)
+
+	start := page * searchPageSize
+	end := min(start+searchPageSize, len(r.Quotes))
+
+	e := make([]*discordgo.MessageEmbed, 0, end-start)
+	for x := start; x < end; x++ {
+		e = append(e, quoteEmbed(fmt.Sprintf("Search Result %d", x+1), r.Quotes[x]))
+	}
+	if len(e) > 0 {
+		count := fmt.Sprintf("%d results", len(r.Quotes))
+		if r.Total > len(r.Quotes) {
+			count = fmt.Sprintf("first %d of %d results", len(r.Quotes), r.Total)
+		}
+		e[len(e)-1].Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Page %d of %d · %s for %q", page+1, pages, count, r.Term),
+		}
+	}
+
+	data := &discordgo.InteractionResponseData{Embeds: e}
+	if pages > 1 {
+		// the previous and next pages always differ, which keeps the two custom IDs unique
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{
+				Components: []discordgo.MessageComponent{
+					discordgo.Button{
+						Label:    "Previous",
+						Style:    discordgo.SecondaryButton,
+						CustomID: searchButtonID(key, page-1),
+						Disabled: page == 0,
+					},
+					discordgo.Button{
+						Label:    "Next",
+						Style:    discordgo.SecondaryButton,
+						CustomID: searchButtonID(key, page+1),
+						Disabled: page == pages-1,
+					},
+				},
+			},
+		}
+	}
+	return data
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func testResults(n int) *searchResults {
+	r := &searchResults{Term: "term"}
+	for x := 0; x < n; x++ {
+		r.Quotes = append(r.Quotes, Quote{ID: int64(x + 1), Quote: fmt.Sprintf("quote %d", x+1), Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now()})
+	}
+	return r
+}
+
+// pageButtons returns the Previous and Next buttons of a rendered page
+func pageButtons(t *testing.T, d *discordgo.InteractionResponseData) (discordgo.Button, discordgo.Button) {
+	t.Helper()
+	if len(d.Components) != 1 {
+		t.Fatalf("expected one actions row, got %d", len(d.Components))
+	}
+	row := d.Components[0].(discordgo.ActionsRow)
+	return row.Components[0].(discordgo.Button), row.Components[1].(discordgo.Button)
+}
+
+func TestSearchPage(t *testing.T) {
+	r := testResults(12)
+
+	d := searchPage("42", r, 0)
+	if len(d.Embeds) != searchPageSize {
+		t.Fatalf("expected %d embeds on the first page, got %d", searchPageSize, len(d.Embeds))
+	}
+	if d.Embeds[0].Title != "Search Result 1 #1" {
+		t.Errorf("first title = %q", d.Embeds[0].Title)
+	}
+	if want := `Page 1 of 3 · 12 results for "term"`; d.Embeds[len(d.Embeds)-1].Footer.Text != want {
+		t.Errorf("footer = %q, want %q", d.Embeds[len(d.Embeds)-1].Footer.Text, want)
+	}
+	prev, next := pageButtons(t, d)
+	if !prev.Disabled || next.Disabled {
+		t.Errorf("first page: prev disabled = %v, next disabled = %v", prev.Disabled, next.Disabled)
+	}
+	if next.CustomID != "search:42:1" {
+		t.Errorf("next custom ID = %q", next.CustomID)
+	}
+
+	// out of range pages are clamped to the last page
+	d = searchPage("42", r, 7)
+	if len(d.Embeds) != 2 || d.Embeds[0].Title != "Search Result 11 #11" {
+		t.Fatalf("unexpected last page: %d embeds", len(d.Embeds))
+	}
+	prev, next = pageButtons(t, d)
+	if prev.Disabled || !next.Disabled {
+		t.Errorf("last page: prev disabled = %v, next disabled = %v", prev.Disabled, next.Disabled)
+	}
+	if prev.CustomID == next.CustomID {
+		t.Errorf("button custom IDs must be unique, both are %q", prev.CustomID)
+	}
+
+	// results past searchLimit are counted but not held
+	r.Total = 250
+	d = searchPage("42", r, 0)
+	if want := `Page 1 of 3 · first 12 of 250 results for "term"`; d.Embeds[len(d.Embeds)-1].Footer.Text != want {
+		t.Errorf("footer = %q, want %q", d.Embeds[len(d.Embeds)-1].Footer.Text, want)
+	}
+
+	// a single page needs no buttons
+	if d := searchPage("42", testResults(3), 0); len(d.Components) != 0 {
+		t.Errorf("expected no buttons for a single page, got %d rows", len(d.Components))
+	}
+}
+
+func TestParseSearchButtonID(t *testing.T) {
+	key, page, err := parseSearchButtonID(searchButtonID("123", -1))
+	if err != nil {
+		t.Fatalf("parseSearchButtonID: %v", err)
+	}
+	if key != "123" || page != -1 {
+		t.Errorf("got key %q page %d, want 123 and -1", key, page)
+	}
+
+	for _, id := range []string{"search:123", "other:123:1", "search:123:x"} {
+		if _, _, err := parseSearchButtonID(id); err == nil {
+			t.Errorf("expected error for %q", id)
+		}
+	}
+}
+
+func TestSearchCacheExpiry(t *testing.T) {
+	c := newSearchCache()
+	c.put("fresh", testResults(1))
+	c.put("stale", testResults(1))
+
+	if _, ok := c.get("fresh"); !ok {
+		t.Error("expected fresh search to be cached")
+	}
+
+	c.results["stale"].Expires = time.Now().Add(-time.Second)
+	if _, ok := c.get("stale"); ok {
+		t.Error("expected expired search to be dropped")
+	}
+
+	// expired entries are swept on the next put
+	c.put("another", testResults(1))
+	if _, ok := c.results["stale"]; ok {
+		t.Error("expected expired search to be swept")
+	}
+}
+
+func TestSearchCacheLimit(t *testing.T) {
+	c := newSearchCache()
+	for x := 0; x < searchesKept; x++ {
+		c.put(fmt.Sprint(x), testResults(1))
+	}
+	// searches put in the same instant would tie, so make one clearly the oldest
+	c.results["7"].Expires = time.Now().Add(time.Minute)
+
+	c.put("newest", testResults(1))
+	if len(c.results) != searchesKept {
+		t.Errorf("cache holds %d searches, want %d", len(c.results), searchesKept)
+	}
+	if _, ok := c.get("7"); ok {
+		t.Error("expected the oldest search to be dropped")
+	}
+	if _, ok := c.get("newest"); !ok {
+		t.Error("expected the newest search to be cached")
+	}
+}
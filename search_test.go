@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	cases := []struct {
+		in   string
+		want searchQuery
+	}{
+		{"hello world", searchQuery{{{Text: "hello"}, {Text: "world"}}}},
+		{`"hello world"`, searchQuery{{{Text: "hello world", Phrase: true}}}},
+		{"hel*", searchQuery{{{Text: "hel", Prefix: true}}}},
+		{"a OR b", searchQuery{{{Text: "a"}}, {{Text: "b"}}}},
+		{"a AND NOT b", searchQuery{{{Text: "a"}, {Text: "b", Not: true}}}},
+		{"don't", searchQuery{{{Text: "don t", Phrase: true}}}},
+		{`"unterminated phrase`, searchQuery{{{Text: "unterminated phrase", Phrase: true}}}},
+		// nothing searchable is left once punctuation and lone negations are dropped
+		{"NOT a", nil},
+		{`* : ( )`, nil},
+		{"OR OR", nil},
+	}
+
+	for _, c := range cases {
+		got := parseSearchQuery(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestSearchQueryFTS5(t *testing.T) {
+	q := parseSearchQuery(`quick "brown fox" jump* NOT lazy OR dog`)
+	want := `("quick" AND "brown fox" AND "jump"* NOT "lazy") OR ("dog")`
+	if got := q.fts5(); got != want {
+		t.Errorf("fts5() = %s, want %s", got, want)
+	}
+}
+
+func TestSearchQueryWebsearch(t *testing.T) {
+	q := parseSearchQuery(`quick "brown fox" jump* NOT lazy OR dog`)
+	want := `quick "brown fox" jump -lazy or dog`
+	if got := q.websearch(); got != want {
+		t.Errorf("websearch() = %s, want %s", got, want)
+	}
+}
+
+func TestSearchQueryScore(t *testing.T) {
+	q := parseSearchQuery("quick NOT lazy")
+	if q.score("The Quick fox") == 0 {
+		t.Error("expected case-insensitive match")
+	}
+	if q.score("the quick lazy fox") != 0 {
+		t.Error("expected negated term to exclude the match")
+	}
+	if q.score("quicker") != 0 {
+		t.Error("expected whole-word match without a prefix operator")
+	}
+	if parseSearchQuery("qui*").score("quicker") == 0 {
+		t.Error("expected prefix match")
+	}
+}
+
+func TestSearchQuerySyntax(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for x, text := range []string{"the quick brown fox", "quick thinking saves the day", "brown bread", "a quick brown dog"} {
+			insertQuote(t, conn, Quote{Quote: text, Quotee: "<@1>", Quoter: "<@2>", CreatedAt: base.AddDate(0, 0, x), GuildID: testGuild})
+		}
+
+		cases := []struct {
+			query string
+			want  int
+		}{
+			{`"quick brown"`, 2},
+			{`quick NOT brown`, 1},
+			{`bread OR thinking`, 2},
+			{`thin*`, 1},
+			{`"brown quick"`, 0},
+			{`NOT quick`, 0},
+		}
+		for _, c := range cases {
+			results, err := conn.searchQuote(ctx, testGuild, c.query, searchByRelevance, "")
+			if err != nil {
+				t.Fatalf("searchQuote(%q): %v", c.query, err)
+			}
+			if len(results) != c.want {
+				t.Errorf("searchQuote(%q) returned %d results, want %d", c.query, len(results), c.want)
+			}
+		}
+
+		results, err := conn.searchQuote(ctx, testGuild, "brown", searchByDate, "")
+		if err != nil {
+			t.Fatalf("searchQuote by date: %v", err)
+		}
+		if len(results) != 3 || results[0].Quote != "a quick brown dog" || results[2].Quote != "the quick brown fox" {
+			t.Errorf("unexpected date order: %+v", results)
+		}
+	})
+}
+
+func TestSearchCountPastLimit(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for x := 0; x < searchLimit+5; x++ {
+			insertQuote(t, conn, Quote{Quote: fmt.Sprintf("cake %d", x), Quotee: "<@1>", Quoter: "<@2>", CreatedAt: base.Add(time.Duration(x) * time.Minute), GuildID: testGuild})
+		}
+		insertQuote(t, conn, Quote{Quote: "pie", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: base, GuildID: testGuild})
+
+		results, err := conn.searchQuote(ctx, testGuild, "cake", searchByDate, "")
+		if err != nil {
+			t.Fatalf("searchQuote: %v", err)
+		}
+		if len(results) != searchLimit {
+			t.Errorf("searchQuote returned %d results, want %d", len(results), searchLimit)
+		}
+
+		count, err := conn.searchCount(ctx, testGuild, "cake", "")
+		if err != nil {
+			t.Fatalf("searchCount: %v", err)
+		}
+		if count != searchLimit+5 {
+			t.Errorf("searchCount = %d, want %d", count, searchLimit+5)
+		}
+	})
+}
+
+func TestSearchByDateAcrossOffsets(t *testing.T) {
+	forEachStore(t, func(t *testing.T, conn QuoteStore) {
+		ctx := context.Background()
+		utc2 := time.FixedZone("UTC+2", 2*60*60)
+		// as text the UTC+2 time sorts after the others, though it is the earliest instant
+		insertQuote(t, conn, Quote{Quote: "offset cake", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, utc2), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "later cake", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC), GuildID: testGuild})
+		insertQuote(t, conn, Quote{Quote: "latest cake", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Date(2024, 3, 1, 11, 0, 0, 500000000, time.UTC), GuildID: testGuild})
+
+		results, err := conn.searchQuote(ctx, testGuild, "cake", searchByDate, "")
+		if err != nil {
+			t.Fatalf("searchQuote: %v", err)
+		}
+		var got []string
+		for _, q := range results {
+			got = append(got, q.Quote)
+		}
+		if want := []string{"latest cake", "later cake", "offset cake"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("date order = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestFTSSearchRankingAndStemming(t *testing.T) {
+	conn := newTestDB(t)
+	ctx := context.Background()
+
+	insertQuote(t, conn, Quote{Quote: "I think the cats ran off with some other things from the kitchen", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, conn, Quote{Quote: "cat cat cat", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+	insertQuote(t, conn, Quote{Quote: "running late", Quotee: "<@1>", Quoter: "<@2>", CreatedAt: time.Now(), GuildID: testGuild})
+
+	results, err := conn.searchQuote(ctx, testGuild, "cat", searchByRelevance, "")
+	if err != nil {
+		t.Fatalf("searchQuote: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected stemmed match on both cat quotes, got %d", len(results))
+	}
+	if results[0].Quote != "cat cat cat" {
+		t.Errorf("expected the denser match first, got %q", results[0].Quote)
+	}
+
+	results, err = conn.searchQuote(ctx, testGuild, "runs", searchByRelevance, "")
+	if err != nil {
+		t.Fatalf("searchQuote stemmed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected %q to match %q, got %d results", "runs", "running late", len(results))
+	}
+}
+
+func TestFTSIndexesExistingQuotes(t *testing.T) {
+	db := openMemDB(t)
+	ctx := context.Background()
+
+	// stop before the search index exists, insert, then finish migrating
+	if err := migrate(ctx, db, migrationEnv{Table: "quotes"}, sqliteMigrations[:2]); err != nil {
+		t.Fatalf("migrate to v2: %v", err)
+	}
+	_, err := db.Exec(`INSERT INTO quotes (quote, quotee, quoter, createdAt, guild) VALUES (?, ?, ?, ?, ?)`,
+		"indexed later", "<@1>", "<@2>", time.Now(), testGuild)
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if err := migrate(ctx, db, migrationEnv{Table: "quotes"}, sqliteMigrations); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	conn := &SQLConn{Conn: db, Table: "quotes", Cache: &QuoteCache{}, Dialect: dialectSQLite}
+	results, err := conn.searchQuote(ctx, testGuild, "later", searchByRelevance, "")
+	if err != nil {
+		t.Fatalf("searchQuote: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("expected pre-existing quote to be indexed, got %d results", len(results))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// statsInterval is the span of time each bar of a stats chart counts the quotes of
+type statsInterval string
+
+const (
+	statsWeek  statsInterval = "week"
+	statsMonth statsInterval = "month"
+)
+
+// start returns the first moment of the UTC week or month t falls in. Weeks start on Monday.
+func (iv statsInterval) start(t time.Time) time.Time {
+	t = t.UTC()
+	if iv == statsWeek {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the start of the interval after the one starting at start
+func (iv statsInterval) next(start time.Time) time.Time {
+	if iv == statsWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// label names the interval starting at start on a chart axis
+func (iv statsInterval) label(start time.Time) string {
+	if iv == statsWeek {
+		return start.Format(time.DateOnly)
+	}
+	return start.Format("Jan 2006")
+}
+
+// activityCount is the number of quotes created in the interval beginning at Start
+type activityCount struct {
+	Start time.Time
+	Count int
+}
+
+// statsChartName is the file name a stats chart is attached as
+const statsChartName = "quote-stats.png"
+
+// statsBars is the most intervals a chart shows, the most recent ones
+const statsBars = 52
+
+// fillActivity turns the intervals that have quotes, oldest first, into one bar per interval from the first of them
+// through the one now falls in, keeping the last statsBars
+func fillActivity(counts []activityCount, iv statsInterval, now time.Time) []activityCount {
+	if len(counts) == 0 {
+		return nil
+	}
+	last := iv.start(now)
+	if newest := counts[len(counts)-1].Start; newest.After(last) {
+		last = newest
+	}
+
+	var bars []activityCount
+	next := 0
+	for start := counts[0].Start; !start.After(last); start = iv.next(start) {
+		bar := activityCount{Start: start}
+		if next < len(counts) && counts[next].Start.Equal(start) {
+			bar.Count = counts[next].Count
+			next++
+		}
+		bars = append(bars, bar)
+	}
+	if len(bars) > statsBars {
+		bars = bars[len(bars)-statsBars:]
+	}
+	return bars
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	// the margins around the plot leave room for the title and the axis labels
+	chartTop    = 40
+	chartBottom = 30
+	chartLeft   = 50
+	chartRight  = 20
+)
+
+var (
+	chartBackground = color.RGBA{0x31, 0x33, 0x38, 0xff} // Discord's dark theme
+	chartGrid       = color.RGBA{0x4e, 0x50, 0x58, 0xff}
+	chartText       = color.RGBA{0xdb, 0xde, 0xe1, 0xff}
+	chartBar        = color.RGBA{0x58, 0x65, 0xf2, 0xff}
+)
+
+// renderActivityChart draws bars as a PNG bar chart headed by title
+func renderActivityChart(title string, bars []activityCount, iv statsInterval) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(chartBackground), image.Point{}, draw.Src)
+	plot := image.Rect(chartLeft, chartTop, chartWidth-chartRight, chartHeight-chartBottom)
+
+	text := &font.Drawer{Dst: img, Src: image.NewUniform(chartText), Face: basicfont.Face7x13}
+	drawText := func(s string, x, y int) {
+		text.Dot = fixed.P(x, y)
+		text.DrawString(s)
+	}
+	textWidth := func(s string) int { return text.MeasureString(s).Ceil() }
+
+	drawText(title, chartLeft, chartTop/2+5)
+
+	// four or so gridlines, at whole numbers of quotes
+	most := 1
+	for _, bar := range bars {
+		most = max(most, bar.Count)
+	}
+	step := (most + 3) / 4
+	top := (most + step - 1) / step * step
+	for tick := 0; tick <= top; tick += step {
+		y := plot.Max.Y - tick*plot.Dy()/top
+		draw.Draw(img, image.Rect(plot.Min.X, y, plot.Max.X, y+1), image.NewUniform(chartGrid), image.Point{}, draw.Src)
+		label := fmt.Sprint(tick)
+		drawText(label, plot.Min.X-8-textWidth(label), y+4)
+	}
+
+	if len(bars) == 0 {
+		return encodePNG(img)
+	}
+
+	// label every few bars so the labels never overlap
+	slot := float64(plot.Dx()) / float64(len(bars))
+	every := int(float64(textWidth(iv.label(bars[0].Start))+16)/slot) + 1
+	for x, bar := range bars {
+		left := plot.Min.X + int(float64(x)*slot+slot*0.15)
+		right := plot.Min.X + int(float64(x+1)*slot-slot*0.15)
+		right = max(right, left+1)
+		height := bar.Count * plot.Dy() / top
+		draw.Draw(img, image.Rect(left, plot.Max.Y-height, right, plot.Max.Y), image.NewUniform(chartBar), image.Point{}, draw.Src)
+
+		if x%every == 0 {
+			label := iv.label(bar.Start)
+			center := plot.Min.X + int((float64(x)+0.5)*slot)
+			drawText(label, max(0, min(center-textWidth(label)/2, chartWidth-textWidth(label))), plot.Max.Y+18)
+		}
+	}
+	return encodePNG(img)
+}
+
+// encodePNG encodes an image as a PNG file
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encodePNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestStatsIntervalStart(t *testing.T) {
+	utc2 := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		iv   statsInterval
+		t    time.Time
+		want string
+	}{
+		{statsWeek, time.Date(2024, time.March, 4, 9, 0, 0, 0, time.UTC), "2024-03-04"},   // a Monday
+		{statsWeek, time.Date(2024, time.March, 10, 23, 0, 0, 0, time.UTC), "2024-03-04"}, // the Sunday after
+		{statsWeek, time.Date(2024, time.March, 4, 1, 0, 0, 0, utc2), "2024-02-26"},       // still Sunday in UTC
+		{statsMonth, time.Date(2024, time.March, 1, 1, 0, 0, 0, utc2), "2024-02-01"},
+		{statsMonth, time.Date(2024, time.December, 31, 12, 0, 0, 0, time.UTC), "2024-12-01"},
+	}
+	for _, tt := range tests {
+		if got := tt.iv.start(tt.t).Format(time.DateOnly); got != tt.want {
+			t.Errorf("%s start of %v = %s, want %s", tt.iv, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestFillActivity(t *testing.T) {
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC) }
+	counts := []activityCount{{month(time.January), 3}, {month(time.April), 1}}
+
+	bars := fillActivity(counts, statsMonth, time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC))
+	want := []int{3, 0, 0, 1, 0, 0}
+	if len(bars) != len(want) {
+		t.Fatalf("got %d bars, want %d", len(bars), len(want))
+	}
+	for x, bar := range bars {
+		if !bar.Start.Equal(month(time.January).AddDate(0, x, 0)) || bar.Count != want[x] {
+			t.Errorf("bar %d = %v with %d, want %d", x, bar.Start, bar.Count, want[x])
+		}
+	}
+
+	// only the most recent weeks fit on a chart
+	bars = fillActivity(counts, statsWeek, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if len(bars) != statsBars || bars[len(bars)-1].Start.Format(time.DateOnly) != "2025-12-29" {
+		t.Errorf("got %d weeks ending %v, want %d ending 2025-12-29", len(bars), bars[len(bars)-1].Start, statsBars)
+	}
+
+	if bars := fillActivity(nil, statsWeek, time.Now()); bars != nil {
+		t.Errorf("bars without quotes = %v", bars)
+	}
+}
+
+func TestRenderActivityChart(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	bars := []activityCount{{start, 2}, {start.AddDate(0, 1, 0), 0}, {start.AddDate(0, 2, 0), 8}}
+
+	chart, err := renderActivityChart("Quotes per month", bars, statsMonth)
+	if err != nil {
+		t.Fatalf("renderActivityChart: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(chart))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != chartWidth || size.Y != chartHeight {
+		t.Fatalf("chart is %v, want %dx%d", size, chartWidth, chartHeight)
+	}
+
+	// sample the middle of each bar's slot just above the axis and just below the top of the plot
+	plotWidth := chartWidth - chartLeft - chartRight
+	sample := func(bar, y int) bool {
+		x := chartLeft + plotWidth*(2*bar+1)/(2*len(bars))
+		return img.At(x, y) == chartBar
+	}
+	bottom, top := chartHeight-chartBottom-1, chartTop+1
+	if !sample(0, bottom) || sample(0, top) {
+		t.Error("expected the first bar to be short")
+	}
+	if sample(1, bottom) {
+		t.Error("expected no bar for an empty month")
+	}
+	if !sample(2, bottom) || !sample(2, top) {
+		t.Error("expected the busiest bar to fill the plot")
+	}
+
+	again, _ := renderActivityChart("Quotes per month", bars, statsMonth)
+	if !bytes.Equal(chart, again) {
+		t.Error("expected the same chart every time")
+	}
+}
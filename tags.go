@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	maxTags      = 5  // most tags a quote may have
+	maxTagLength = 32 // longest tag name in characters
+	// noTags is what clears a quote's tags when given in place of a list
+	noTags = "none"
+	// tagListLimit is the most tags /quote tags lists
+	tagListLimit = 50
+	// Discord shows at most 25 suggestions, each at most 100 characters long
+	maxChoices      = 25
+	maxChoiceLength = 100
+)
+
+// tagCount is a tag and the number of quotes in a guild that have it
+type tagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// normalizeTag turns a tag as typed into the form it is stored in: lowercase, with words joined by dashes. Errors are
+// meant to be shown to the user.
+func normalizeTag(s string) (string, error) {
+	tag := strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return unicode.IsSpace(r) || r == '_'
+	}), "-")
+	if tag == "" {
+		return "", fmt.Errorf("tags cannot be empty")
+	}
+	if len([]rune(tag)) > maxTagLength {
+		return "", fmt.Errorf("tags must be at most %d characters, %q is longer", maxTagLength, tag)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+			return "", fmt.Errorf("tags may only contain letters, numbers and dashes, not %q", s)
+		}
+	}
+	if tag == noTags {
+		return "", fmt.Errorf("%q cannot be used as a tag", noTags)
+	}
+	return tag, nil
+}
+
+// parseTags reads a comma-separated list of tags into sorted, distinct tag names. Errors are meant to be shown to
+// the user.
+func parseTags(s string) ([]string, error) {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		tag, err := normalizeTag(part)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("a quote can have at most %d tags", maxTags)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// filterTag reads the tag a command filters quotes by, which is empty when the user gave none. Errors are meant to
+// be shown to the user.
+func filterTag(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	return normalizeTag(s)
+}
+
+// taggedWith describes the tag quotes were filtered by, for appending to a message about them
+func taggedWith(tag string) string {
+	if tag == "" {
+		return ""
+	}
+	return fmt.Sprintf(" tagged `%s`", tag)
+}
+
+// hasTag reports whether a quote has the tag, which any quote has when tag is empty
+func (q Quote) hasTag(tag string) bool {
+	if tag == "" {
+		return true
+	}
+	for _, t := range q.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTags renders tag counts as one line per tag
+func formatTags(tags []tagCount) string {
+	lines := make([]string, 0, len(tags))
+	for _, t := range tags {
+		lines = append(lines, fmt.Sprintf("`%s`: %s", t.Name, plural(t.Count, "quote")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tagChoices suggests the guild's tags that start with what the user typed, most used first. With list set, the
+// option holds a comma-separated list and the suggestions complete its last tag.
+func tagChoices(ctx context.Context, c *HandlerContext, guild string, typed string, list bool) []*discordgo.ApplicationCommandOptionChoice {
+	// done holds the tags typed in full, up to and including the last comma
+	done, partial := "", typed
+	if list {
+		if x := strings.LastIndex(typed, ","); x >= 0 {
+			done, partial = typed[:x+1], typed[x+1:]
+		}
+	}
+	partial = strings.Join(strings.Fields(strings.ToLower(partial)), "-")
+	chosen := make(map[string]bool)
+	for _, t := range strings.Split(done, ",") {
+		chosen[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	tags, err := c.DB.listTags(ctx, guild)
+	if err != nil {
+		slog.ErrorContext(ctx, "error listing tags to suggest", "err", err)
+		return nil
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, t := range tags {
+		if !strings.HasPrefix(t.Name, partial) || chosen[t.Name] {
+			continue
+		}
+		value := t.Name
+		if done != "" {
+			value = strings.TrimSpace(done) + " " + t.Name
+		}
+		if len(value) > maxChoiceLength {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: value, Value: value})
+		if len(choices) == maxChoices {
+			break
+		}
+	}
+	return choices
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "", want: ""},
+		{in: " , ,", want: ""},
+		{in: "Work, in jokes,work", want: "in-jokes,work"},
+		{in: "snake_case,  Ünïcode ", want: "snake-case,ünïcode"},
+		{in: "a,b,c,d,e", want: "a,b,c,d,e"},
+		{in: "a,b,c,d,e,f", wantErr: "at most 5 tags"},
+		{in: "wow!", wantErr: "letters, numbers and dashes"},
+		{in: "none", wantErr: `"none" cannot be used`},
+		{in: strings.Repeat("x", maxTagLength+1), wantErr: "at most 32 characters"},
+	}
+	for _, tt := range tests {
+		tags, err := parseTags(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTags(%q) error = %v, want it to contain %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTags(%q): %v", tt.in, err)
+			continue
+		}
+		if got := strings.Join(tags, ","); got != tt.want {
+			t.Errorf("parseTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFilterTag(t *testing.T) {
+	if tag, err := filterTag("  "); tag != "" || err != nil {
+		t.Errorf(`filterTag("  ") = %q, %v; want no filter`, tag, err)
+	}
+	if tag, err := filterTag("In Jokes"); tag != "in-jokes" || err != nil {
+		t.Errorf(`filterTag("In Jokes") = %q, %v; want in-jokes`, tag, err)
+	}
+	if _, err := filterTag("a,b"); err == nil {
+		t.Error(`filterTag("a,b") succeeded, want an error`)
+	}
+}
+
+func TestFormatTags(t *testing.T) {
+	got := formatTags([]tagCount{{Name: "funny", Count: 3}, {Name: "work", Count: 1}})
+	if want := "`funny`: 3 quotes\n`work`: 1 quote"; got != want {
+		t.Errorf("formatTags = %q, want %q", got, want)
+	}
+}